@@ -1,5 +1,8 @@
 package fdx
 
+// fdxVersion is the version of the FDX format written to the <FinalDraft> element
+const fdxVersion = "1"
+
 // FDX paragraph type constants used in Final Draft XML format
 const (
 	FDXSceneHeading  = "Scene Heading"
@@ -9,4 +12,15 @@ const (
 	FDXDialogue      = "Dialogue"
 	FDXTransition    = "Transition"
 	FDXGeneral       = "General"
+	FDXOutline       = "Outline" // Followed by the level, e.g. "Outline 1"
+)
+
+// synopsisPrefix starts a General paragraph holding a synopsis that isn't part of a scene summary
+const synopsisPrefix = "= "
+
+// FDX paragraph alignments, used to lay out the title page
+const (
+	FDXAlignLeft   = "Left"
+	FDXAlignCenter = "Center"
+	FDXAlignRight  = "Right"
 )
@@ -2,11 +2,18 @@ package fdx
 
 import (
 	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/LaPingvino/lexington/fountain"
 	"github.com/LaPingvino/lexington/lex"
+	"github.com/LaPingvino/lexington/rules"
 )
 
 // TestFdxRoundTrip tests if parsing an FDX file, writing it back out,
@@ -24,7 +31,7 @@ func TestFdxRoundTrip(t *testing.T) {
 		}
 	}()
 
-	originalScreenplay := Parse(originalFile)
+	originalScreenplay := mustParse(t, originalFile).WithoutPositions()
 	if len(originalScreenplay) == 0 {
 		t.Fatal("Parsing the original file resulted in an empty screenplay.")
 	}
@@ -41,7 +48,7 @@ func TestFdxRoundTrip(t *testing.T) {
 	}
 
 	// 3. Parse the content that was just written to the buffer.
-	roundTripScreenplay := Parse(&buffer)
+	roundTripScreenplay := mustParse(t, &buffer).WithoutPositions()
 	if len(roundTripScreenplay) == 0 {
 		t.Fatal("Parsing the round-tripped file resulted in an empty screenplay.")
 	}
@@ -62,6 +69,47 @@ func TestFdxRoundTrip(t *testing.T) {
 }
 
 // TestParse specifically checks the output of parsing example.fdx against a known-good structure.
+// TestFountainRoundTrip converts Fountain files to FDX and back, which should give the same screenplay.
+// The other files in testdata have page breaks, which FDX doesn't keep.
+func TestFountainRoundTrip(t *testing.T) {
+	scenes := []string{"INT", "EXT", "EST", "INT./EXT", "INT/EXT", "I/E"}
+	files := []string{
+		"basic_screenplay.fountain",
+		"dual_dialogue.fountain",
+		"fountain_example.fountain",
+		"no_title.fountain",
+		"simple_dual.fountain",
+	}
+	for _, name := range files {
+		t.Run(name, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("..", "testdata", "input", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if closeErr := file.Close(); closeErr != nil {
+					t.Logf("Error closing %s: %v", name, closeErr)
+				}
+			}()
+			screenplay := mustParseFountain(t, scenes, file).WithoutPositions()
+
+			var buffer bytes.Buffer
+			if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+				t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+			}
+			got := mustParse(t, &buffer).WithoutPositions()
+			if len(got) != len(screenplay) {
+				t.Fatalf("Length mismatch: original %d, round-trip %d", len(screenplay), len(got))
+			}
+			for i := range screenplay {
+				if !reflect.DeepEqual(got[i], screenplay[i]) {
+					t.Errorf("Line %d mismatch:\n  Original:  %+v\n  RoundTrip: %+v", i, screenplay[i], got[i])
+				}
+			}
+		})
+	}
+}
+
 func TestParse(t *testing.T) {
 	file, err := os.Open("example.fdx")
 	if err != nil {
@@ -73,7 +121,7 @@ func TestParse(t *testing.T) {
 		}
 	}()
 
-	screenplay := Parse(file)
+	screenplay := mustParse(t, file).WithoutPositions()
 
 	expected := lex.Screenplay{
 		lex.Line{Type: lex.TypeScene, Contents: "INT. HOUSE - DAY"},
@@ -107,3 +155,642 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+// TestParsePositions checks that parsed paragraphs point back to their <Paragraph> element.
+func TestParsePositions(t *testing.T) {
+	file, err := os.Open("example.fdx")
+	if err != nil {
+		t.Fatalf("Failed to open example.fdx: %v", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			t.Logf("Error closing file: %v", closeErr)
+		}
+	}()
+
+	screenplay := mustParse(t, file)
+	if len(screenplay) < 2 {
+		t.Fatalf("Expected at least two paragraphs, got %d", len(screenplay))
+	}
+
+	expected := []lex.Position{
+		{File: "example.fdx", Line: 5, Col: 5, EndLine: 7, EndCol: 17},
+		{File: "example.fdx", Line: 8, Col: 5, EndLine: 10, EndCol: 17},
+	}
+	for i, want := range expected {
+		if screenplay[i].Pos != want {
+			t.Errorf("Paragraph %d: got position %+v, expected %+v", i, screenplay[i].Pos, want)
+		}
+	}
+}
+
+// TestScriptNotes checks that hidden notes are written as ScriptNotes and read back,
+// while shown notes become regular paragraphs.
+func TestScriptNotes(t *testing.T) {
+	screenplay := lex.Screenplay{
+		lex.Line{Type: lex.TypeAction, Contents: "Mary enters."},
+		lex.Line{Type: lex.TypeNote, Contents: "Check the lighting\nand the sound"},
+		lex.Line{Type: lex.TypeBoneyard, Contents: "Cut scene"},
+	}
+
+	var buffer bytes.Buffer
+	writer := &FDXWriter{}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`<ScriptNote ID="1">`)) {
+		t.Errorf("Expected a ScriptNote in the output, got:\n%s", buffer.String())
+	}
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	expected := screenplay[:2]
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Parsed script notes do not match.\n  Got:      %#v\n  Expected: %#v", got, expected)
+	}
+
+	shown := rules.Set{"note": rules.Format{}, "boneyard": rules.Format{}}
+	buffer.Reset()
+	writer = &FDXWriter{Elements: shown}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	if bytes.Contains(buffer.Bytes(), []byte("<ScriptNote")) {
+		t.Errorf("Shown notes should not become ScriptNotes, got:\n%s", buffer.String())
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte("Cut scene")) {
+		t.Errorf("Shown boneyard should be written, got:\n%s", buffer.String())
+	}
+}
+
+// TestSceneNumbers checks that scene numbers are written as the Number attribute and read back.
+func TestSceneNumbers(t *testing.T) {
+	screenplay := lex.Screenplay{
+		lex.Line{Type: lex.TypeScene, Contents: "INT. HOUSE - DAY", SceneNumber: "12A"},
+		lex.Line{Type: lex.TypeAction, Contents: "Mary enters."},
+	}
+
+	var buffer bytes.Buffer
+	writer := &FDXWriter{}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`<Paragraph Type="Scene Heading" Number="12A">`)) {
+		t.Errorf("Expected a Number attribute on the scene heading, got:\n%s", buffer.String())
+	}
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Parsed scene numbers do not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+}
+
+// TestDualDialogue checks that dual dialogue becomes a DualDialogue block and that
+// Fountain dual dialogue survives the way through FDX.
+func TestDualDialogue(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `INT. HOUSE - DAY
+
+BRICK
+Screw retirement.
+
+STEEL ^
+Screw retirement.
+
+They look at each other.
+`
+	screenplay := mustParseFountain(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	if strings.Count(buffer.String(), "<DualDialogue>") != 1 {
+		t.Errorf("Expected one DualDialogue block in the output, got:\n%s", buffer.String())
+	}
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Parsed dual dialogue does not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+
+	buffer.Reset()
+	if err := (&fountain.FountainWriter{SceneConfig: scenes}).Write(&buffer, got); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	if buffer.String() != fountainContent {
+		t.Errorf("Fountain output does not match.\n  Got:      %q\n  Expected: %q", buffer.String(), fountainContent)
+	}
+}
+
+// TestTitlePage checks that the Fountain title page keys survive the way through FDX.
+func TestTitlePage(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `Title: BIG FISH
+Credit: written by
+Author: John August
+Source: based on the novel by Daniel Wallace
+Draft date: 1/1/2003
+contact: Agency & Co.
+Notes: Shooting script
+
+INT. HOUSE - DAY
+
+Edward enters.
+`
+	screenplay := mustParseFountain(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"<TitlePage>",
+		`<Paragraph Alignment="Center">` + "\n        <Text>BIG FISH</Text>",
+		`<Paragraph Alignment="Right">` + "\n        <Text>1/1/2003</Text>",
+		"<Text>Agency &amp; Co.</Text>",
+		"<Text>Notes: Shooting script</Text>",
+	} {
+		if !strings.Contains(buffer.String(), want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, buffer.String())
+		}
+	}
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	expected := append(lex.Screenplay{}, screenplay...)
+	// Keys are matched in any case, FDX gives the usual one back
+	expected[7].Type = lex.KeyContact
+	expected[8] = lex.Line{Type: "Contact", Contents: "Notes: Shooting script"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Parsed title page does not match.\n  Got:      %#v\n  Expected: %#v", got, expected)
+	}
+}
+
+// TestTitlePageNote checks that a note between two title page keys keeps the keys after it on the title page.
+func TestTitlePageNote(t *testing.T) {
+	source := "Title: Big Fish\n[[a note]]\nAuthor: John\n\nEdward enters.\n"
+	screenplay := mustParseFountain(t, []string{"INT", "EXT"}, strings.NewReader(source))
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	_, titlePage, _ := strings.Cut(buffer.String(), "<TitlePage>")
+	if !strings.Contains(titlePage, "<Text>John</Text>") || strings.Contains(buffer.String(), "ScriptNote") {
+		t.Errorf("Expected the author on the title page and no script note, got:\n%s", buffer.String())
+	}
+}
+
+// TestParseTitlePage checks that a Final Draft title page after the content is read by alignment.
+func TestParseTitlePage(t *testing.T) {
+	fdxContent := `<?xml version="1.0" encoding="UTF-8"?>
+<FinalDraft DocumentType="Script" Template="No" Version="4">
+  <Content>
+    <Paragraph Type="Action"><Text>Edward enters.</Text></Paragraph>
+  </Content>
+  <TitlePage>
+    <Content>
+      <Paragraph Alignment="Center"><Text></Text></Paragraph>
+      <Paragraph Alignment="Center"><Text>BIG FISH</Text></Paragraph>
+      <Paragraph Alignment="Center"><Text>Screenplay by</Text></Paragraph>
+      <Paragraph Alignment="Center"><Text>John August</Text></Paragraph>
+      <Paragraph Alignment="Left"><Text>Agency</Text></Paragraph>
+      <Paragraph Alignment="Left"><Text>555-1234</Text></Paragraph>
+      <Paragraph Alignment="Right"><Text>Final Draft</Text></Paragraph>
+    </Content>
+  </TitlePage>
+</FinalDraft>`
+
+	got := mustParse(t, strings.NewReader(fdxContent)).WithoutPositions()
+	expected := lex.Screenplay{
+		{Type: lex.TypeTitlePage},
+		{Type: "Title", Contents: "BIG FISH"},
+		{Type: "Credit", Contents: "Screenplay by"},
+		{Type: "Author", Contents: "John August"},
+		{Type: "metasection"},
+		{Type: "Contact", Contents: "Agency\n555-1234"},
+		{Type: "Draft date", Contents: "Final Draft"},
+		{Type: lex.TypeNewPage},
+		{Type: lex.TypeAction, Contents: "Edward enters."},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Parsed title page does not match.\n  Got:      %#v\n  Expected: %#v", got, expected)
+	}
+}
+
+// mustParse parses an FDX file and fails the test on errors
+func mustParse(t *testing.T, r io.Reader) lex.Screenplay {
+	t.Helper()
+	screenplay, err := Parse(r)
+	if err != nil {
+		t.Fatalf("Parse returned an unexpected error: %v", err)
+	}
+	return screenplay
+}
+
+// mustParseFountain parses a Fountain file and fails the test on errors
+func mustParseFountain(t *testing.T, scenes []string, r io.Reader) lex.Screenplay {
+	t.Helper()
+	screenplay, err := fountain.Parse(scenes, r)
+	if err != nil {
+		t.Fatalf("fountain.Parse returned an unexpected error: %v", err)
+	}
+	return screenplay
+}
+
+// TestParseErrors checks that malformed documents are reported with their position.
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		lines    int // Number of lines parsed before the error
+	}{
+		{
+			name:     "unclosed paragraph",
+			input:    "<FinalDraft>\n  <Content>\n    <Paragraph Type=\"Action\"><Text>Mary enters.</Text></Paragraph>\n    <Paragraph Type=\"Action\"><Text>Oops</Paragraph>\n",
+			expected: "4:52: invalid XML: element <Text> closed by </Paragraph>",
+			lines:    1,
+		},
+		{
+			name:     "wrong root element",
+			input:    "<html><body>Mary enters.</body></html>",
+			expected: "1:1: not a Final Draft document, the root element is <html> instead of <FinalDraft>",
+		},
+		{
+			name:     "empty input",
+			input:    "",
+			expected: "1:1: no <FinalDraft> element found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			screenplay, err := Parse(strings.NewReader(tt.input))
+			var parseErr *lex.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected a lex.ParseError, got %v", err)
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("Got error %q, expected %q", err.Error(), tt.expected)
+			}
+			if len(screenplay) != tt.lines {
+				t.Errorf("Got %d parsed lines, expected %d", len(screenplay), tt.lines)
+			}
+		})
+	}
+}
+
+// TestStyledText checks that styled text runs become Fountain emphasis.
+func TestStyledText(t *testing.T) {
+	tests := []struct {
+		name     string
+		texts    []FdxText
+		expected string
+	}{
+		{
+			name:     "plain",
+			texts:    []FdxText{{Content: "Mary "}, {Content: "enters."}},
+			expected: "Mary enters.",
+		},
+		{
+			name:     "bold with spaces outside",
+			texts:    []FdxText{{Content: "This is"}, {Content: " very bold ", Style: "Bold"}, {Content: "text."}},
+			expected: "This is **very bold** text.",
+		},
+		{
+			name:     "combined styles",
+			texts:    []FdxText{{Content: "all", Style: "Bold+Italic+Underline"}, {Content: " of it"}},
+			expected: "_***all***_ of it",
+		},
+		{
+			name: "nested styles",
+			texts: []FdxText{
+				{Content: "loud ", Style: "Bold"},
+				{Content: "and slanted", Style: "Bold+Italic"},
+				{Content: " voice", Style: "Bold"},
+			},
+			expected: "**loud *and slanted* voice**",
+		},
+		{
+			name:     "merged runs",
+			texts:    []FdxText{{Content: "one", Style: "Underline"}, {Content: " two", Style: "Underline"}},
+			expected: "_one two_",
+		},
+		{
+			name:     "legacy italic",
+			texts:    []FdxText{{Content: "whispering", AdornmentStyle: "-1"}},
+			expected: "*whispering*",
+		},
+		{
+			name:     "other styles are ignored",
+			texts:    []FdxText{{Content: "FADE IN:", Style: "AllCaps"}},
+			expected: "FADE IN:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := styledText(tt.texts); got != tt.expected {
+				t.Errorf("Got %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestInlineMarkupRoundTrip checks that emphasis written to FDX is read back as the same markup.
+func TestInlineMarkupRoundTrip(t *testing.T) {
+	screenplay := lex.Screenplay{
+		lex.Line{Type: lex.TypeAction, Contents: "This is **bold**, *italic*, ***both*** and _underlined_."},
+		lex.Line{Type: lex.TypeAction, Contents: `A _**nested**_ word and a \*literal\* star.`},
+	}
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	got := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Parsed markup does not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+
+	file, err := os.Open("example_inline_formatting.fdx")
+	if err != nil {
+		t.Fatalf("Failed to open example_inline_formatting.fdx: %v", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			t.Logf("Error closing file: %v", closeErr)
+		}
+	}()
+	example := mustParse(t, file)
+	expected := "This is **bold text** and this is *italic text* and this is _underlined text_."
+	if len(example) < 3 || example[2].Contents != expected {
+		t.Errorf("Expected the third paragraph to be %q, got %#v", expected, example)
+	}
+}
+
+// TestRevisions checks that revision sets and the revision IDs of paragraphs are read and written.
+func TestRevisions(t *testing.T) {
+	fdxContent := `<?xml version="1.0" encoding="UTF-8"?>
+<FinalDraft DocumentType="Script" Template="No" Version="4">
+  <Content>
+    <Paragraph Type="Action"><Text RevisionID="0">Mary enters.</Text></Paragraph>
+    <Paragraph Type="Action"><Text RevisionID="0">Mary </Text><Text RevisionID="2">runs away.</Text></Paragraph>
+    <Paragraph Type="Character"><Text RevisionID="1">MARY</Text></Paragraph>
+  </Content>
+  <Revisions ActiveSet="2" Location="7.75" RevisionMode="No">
+    <Revision Color="#000000000000" ID="0" Mark="*" Name="Original Revision" Style=""/>
+    <Revision Color="#00000000FFFF" ID="1" Mark="*" Name="Blue Revision" Style=""/>
+    <Revision Color="#FFFF8080C0C0" ID="2" Mark="*" Name="Pink Revision" Style=""/>
+  </Revisions>
+</FinalDraft>`
+
+	got := mustParse(t, strings.NewReader(fdxContent)).WithoutPositions()
+	expected := lex.Screenplay{
+		{Type: lex.TypeRevision, Contents: "Blue Revision", Revision: 1, Color: "#00000000FFFF", Mark: "*"},
+		{Type: lex.TypeRevision, Contents: "Pink Revision", Revision: 2, Color: "#FFFF8080C0C0", Mark: "*"},
+		{Type: lex.TypeAction, Contents: "Mary enters."},
+		{Type: lex.TypeAction, Contents: "Mary runs away.", Revision: 2},
+		{Type: lex.TypeSpeaker, Contents: "MARY", Revision: 1},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Parsed revisions do not match.\n  Got:      %#v\n  Expected: %#v", got, expected)
+	}
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, got); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	for _, want := range []string{`<Revisions ActiveSet="2">`, `Color="#FFFF8080C0C0"`, `Name="Pink Revision"`,
+		`<Text RevisionID="2">Mary runs away.</Text>`} {
+		if !strings.Contains(buffer.String(), want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, buffer.String())
+		}
+	}
+	roundTrip := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(roundTrip, expected) {
+		t.Errorf("Round-tripped revisions do not match.\n  Got:      %#v\n  Expected: %#v", roundTrip, expected)
+	}
+}
+
+// TestOutline checks that sections and synopses survive the way through FDX.
+func TestOutline(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `# Act One
+
+= The setup.
+
+## Meeting
+
+INT. HOUSE - DAY
+
+= Mary meets Tom.
+
+Mary enters.
+`
+	screenplay := mustParseFountain(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	for _, want := range []string{`<Paragraph Type="Outline 2">`, "<Summary>", "<Text>Mary meets Tom.</Text>"} {
+		if !strings.Contains(buffer.String(), want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, buffer.String())
+		}
+	}
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Parsed outline does not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+
+	buffer.Reset()
+	if err := (&fountain.FountainWriter{SceneConfig: scenes}).Write(&buffer, got); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	if buffer.String() != fountainContent {
+		t.Errorf("Fountain output does not match.\n  Got:      %q\n  Expected: %q", buffer.String(), fountainContent)
+	}
+}
+
+// TestSynopsisPlacement checks that only synopses right after a heading go into its summary,
+// others stay where they are.
+func TestSynopsisPlacement(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `= Before it all.
+
+INT. HOUSE - DAY
+
+= Mary meets Tom.
+
+Mary enters.
+
+= Things go wrong.
+
+Tom leaves.
+`
+	screenplay := mustParseFountain(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	output := buffer.String()
+	if strings.Count(output, "<Summary>") != 1 {
+		t.Errorf("Expected only the scene heading to have a summary, got:\n%s", output)
+	}
+	for _, want := range []string{"<Text>= Before it all.</Text>", "<Text>= Things go wrong.</Text>"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, output)
+		}
+	}
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Parsed synopses do not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+}
+
+// wellFormed fails the test if data isn't well-formed XML
+func wellFormed(t *testing.T, data []byte) {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("Output is not well-formed XML: %v\n%s", err, data)
+		}
+	}
+}
+
+// TestXMLRoundTrip checks that text with characters that are special in XML gives
+// a well-formed document that parses back to the same screenplay.
+func TestXMLRoundTrip(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	tests := map[string]string{
+		"action":     "INT. BAR - NIGHT\n\nTom & Jerry <3 each other > everyone \"else\" 'really'.\n",
+		"cdata end":  "INT. BAR - NIGHT\n\nThe code reads ]]> and &amp; literally.\n",
+		"dialogue":   "INT. BAR - NIGHT\n\nA&B\n(<quietly>)\nIf x < y && y > z, then \"yes\".\n",
+		"note":       "INT. BAR - NIGHT\n\nMary enters.\n[[Check <this> & \"that\"]]\n",
+		"synopsis":   "INT. BAR - NIGHT\n\n= Love & <war>.\n\nMary enters.\n",
+		"section":    "# Act <One> & Only\n\nINT. BAR - NIGHT\n",
+		"title page": "Title: Tom & Jerry\nContact: Agent <agent@example.com>\n\nINT. BAR - NIGHT\n",
+	}
+	for name, fountainContent := range tests {
+		t.Run(name, func(t *testing.T) {
+			screenplay := mustParseFountain(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+			var buffer bytes.Buffer
+			if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+				t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+			}
+			wellFormed(t, buffer.Bytes())
+
+			got := mustParse(t, &buffer).WithoutPositions()
+			if !reflect.DeepEqual(got, screenplay) {
+				t.Errorf("Round-tripped screenplay does not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+			}
+		})
+	}
+
+	t.Run("revision", func(t *testing.T) {
+		screenplay := lex.Screenplay{
+			{Type: lex.TypeRevision, Contents: `Blue & "Pink" <Revision>`, Revision: 1, Mark: "*"},
+			{Type: lex.TypeAction, Contents: "Mary & Tom run.", Revision: 1},
+		}
+		var buffer bytes.Buffer
+		if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+			t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+		}
+		wellFormed(t, buffer.Bytes())
+
+		got := mustParse(t, &buffer).WithoutPositions()
+		if !reflect.DeepEqual(got, screenplay) {
+			t.Errorf("Round-tripped revision does not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+		}
+	})
+}
+
+// TestCustomTemplate checks that custom templates get text escaped for XML.
+func TestCustomTemplate(t *testing.T) {
+	const customTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<FinalDraft Version="1">
+  <Content>
+{{range .Paragraphs}}    <Paragraph Type="{{.Type}}">{{range .Texts}}<Text>{{.Content}}</Text>{{end}}</Paragraph>
+{{end}}  </Content>
+</FinalDraft>
+`
+	path := filepath.Join(t.TempDir(), "custom.fdx")
+	if err := os.WriteFile(path, []byte(customTemplate), 0o600); err != nil {
+		t.Fatalf("Failed to write the template: %v", err)
+	}
+
+	screenplay := lex.Screenplay{
+		{Type: lex.TypeScene, Contents: "INT. BAR & GRILL - NIGHT"},
+		{Type: lex.TypeAction, Contents: "Tom <3 Jerry."},
+	}
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{TemplatePath: path}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	wellFormed(t, buffer.Bytes())
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Parsed template output does not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+}
+
+// TestBaselineTemplate checks that templates writing {{.Content}} without escapeXML get escaped text,
+// as they did before escapeXML was added, also where the text itself looks like an entity.
+func TestBaselineTemplate(t *testing.T) {
+	const customTemplate = `{{range .Paragraphs}}{{range .Texts}}{{.Content}}|{{escapeXML "<&>"}}{{end}}{{end}}`
+	path := filepath.Join(t.TempDir(), "baseline.fdx")
+	if err := os.WriteFile(path, []byte(customTemplate), 0o600); err != nil {
+		t.Fatalf("Failed to write the template: %v", err)
+	}
+
+	screenplay := lex.Screenplay{{Type: lex.TypeAction, Contents: "a < b & c, type &amp; for &"}}
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{TemplatePath: path}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	if got, expected := buffer.String(), "a &lt; b &amp; c, type &amp;amp; for &amp;|&lt;&amp;&gt;"; got != expected {
+		t.Errorf("Template output does not match.\n  Got:      %q\n  Expected: %q", got, expected)
+	}
+}
+
+// TestExtensions checks that character extensions are written as text runs of their own,
+// listed for SmartType and read back.
+func TestExtensions(t *testing.T) {
+	screenplay := lex.Screenplay{
+		{Type: lex.TypeSpeaker, Contents: "JOHN", Extensions: []string{"V.O."}},
+		{Type: lex.TypeDialog, Contents: "Hello."},
+		{Type: lex.TypeEmpty},
+		{Type: lex.TypeSpeaker, Contents: "JOHN", Extensions: []string{"O.S.", "CONT'D"}},
+		{Type: lex.TypeDialog, Contents: "Again."},
+	}
+
+	var buffer bytes.Buffer
+	if err := (&FDXWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FDXWriter.Write returned an unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"<Text>JOHN</Text>\n      <Text> (V.O.)</Text>",
+		"<Character>JOHN</Character>",
+		"<Extension>(V.O.)</Extension>\n      <Extension>(O.S.)</Extension>\n      <Extension>(CONT&#39;D)</Extension>",
+	} {
+		if !strings.Contains(buffer.String(), want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, buffer.String())
+		}
+	}
+
+	got := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Parsed extensions do not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+}
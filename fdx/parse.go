@@ -3,8 +3,13 @@
 package fdx
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"io"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/LaPingvino/lexington/lex"
@@ -12,8 +17,34 @@ import (
 
 // FdxFile represents the top-level <FinalDraft> element.
 type FdxFile struct {
-	XMLName xml.Name   `xml:"FinalDraft"`
-	Content FdxContent `xml:"Content"`
+	XMLName   xml.Name      `xml:"FinalDraft"`
+	Version   string        `xml:"Version,attr,omitempty"`
+	Content   FdxContent    `xml:"Content"`
+	TitlePage *FdxTitlePage `xml:"TitlePage"`
+	Revisions *FdxRevisions `xml:"Revisions"`
+	SmartType *FdxSmartType `xml:"SmartType"`
+}
+
+// FdxSmartType represents the <SmartType> lists Final Draft suggests character names
+// and extensions from while typing. Extensions are listed with their parentheses.
+type FdxSmartType struct {
+	Characters []string `xml:"Characters>Character"`
+	Extensions []string `xml:"Extensions>Extension"`
+}
+
+// FdxRevisions represents the <Revisions> element, which lists the revision sets of the script.
+type FdxRevisions struct {
+	ActiveSet string        `xml:"ActiveSet,attr,omitempty"`
+	Revisions []FdxRevision `xml:"Revision"`
+}
+
+// FdxRevision represents a single revision set. Text runs changed in it refer to its ID.
+// ID 0 is the original, unrevised text.
+type FdxRevision struct {
+	ID    string `xml:"ID,attr"`
+	Name  string `xml:"Name,attr"`
+	Color string `xml:"Color,attr,omitempty"`
+	Mark  string `xml:"Mark,attr,omitempty"`
 }
 
 // FdxContent represents the <Content> element, which contains paragraphs.
@@ -24,9 +55,41 @@ type FdxContent struct {
 
 // FdxParagraph represents a <Paragraph> element, which can be a scene heading, action, etc.
 type FdxParagraph struct {
-	XMLName xml.Name  `xml:"Paragraph"`
-	Type    string    `xml:"Type,attr"`
-	Texts   []FdxText `xml:"Text"`
+	XMLName         xml.Name            `xml:"Paragraph"`
+	Type            string              `xml:"Type,attr,omitempty"`
+	Number          string              `xml:"Number,attr,omitempty"`
+	Alignment       string              `xml:"Alignment,attr,omitempty"`
+	SceneProperties *FdxSceneProperties `xml:"SceneProperties"`
+	ScriptNotes     []FdxScriptNote     `xml:"ScriptNote"`
+	DualDialogue    *FdxDualDialogue    `xml:"DualDialogue"`
+	Texts           []FdxText           `xml:"Text"`
+}
+
+// FdxSceneProperties represents the <SceneProperties> of a scene heading or outline element.
+// Its summary holds the synopsis, one paragraph per Fountain = synopsis line.
+type FdxSceneProperties struct {
+	Length  string      `xml:"Length,attr,omitempty"`
+	Page    string      `xml:"Page,attr,omitempty"`
+	Title   string      `xml:"Title,attr,omitempty"`
+	Summary *FdxSummary `xml:"Summary"`
+}
+
+// FdxSummary represents the <Summary> of a scene.
+type FdxSummary struct {
+	Paragraphs []FdxParagraph `xml:"Paragraph"`
+}
+
+// FdxDualDialogue represents a <DualDialogue> block inside a paragraph, holding two speeches
+// that are said at the same time. The second Character paragraph starts the right column.
+type FdxDualDialogue struct {
+	Paragraphs []FdxParagraph `xml:"Paragraph"`
+}
+
+// FdxScriptNote represents a <ScriptNote> attached to a paragraph.
+// Script notes are not printed by Final Draft, which matches Fountain [[notes]].
+type FdxScriptNote struct {
+	ID         string         `xml:"ID,attr,omitempty"`
+	Paragraphs []FdxParagraph `xml:"Paragraph"`
 }
 
 // FdxText represents a <Text> element which contains the actual script content.
@@ -43,50 +106,279 @@ type FdxText struct {
 }
 
 // Parse reads an .fdx file from an io.Reader and converts it into the internal lex.Screenplay format.
-func Parse(file io.Reader) (out lex.Screenplay) {
-	var fdxFile FdxFile
-	decoder := xml.NewDecoder(file)
-	err := decoder.Decode(&fdxFile)
+// Each line records the position of its <Paragraph> element in the source. The title page
+// comes first, whether the <TitlePage> element is before or after the <Content>, followed by
+// the revision sets. Paragraphs changed in a revision keep the ID of the latest set they were changed in.
+// Malformed XML and documents that aren't Final Draft files are reported as a lex.ParseError,
+// together with everything that was parsed before the problem.
+func Parse(file io.Reader) (lex.Screenplay, error) {
+	name := lex.SourceName(file)
+	data, err := io.ReadAll(file)
 	if err != nil {
-		// In a real-world scenario, you'd want better error handling.
-		// For now, we'll return what we have if a decoding error occurs mid-stream.
-		return
+		return nil, &lex.ParseError{Pos: lex.Position{File: name}, Err: err}
 	}
+	src := newSource(name, data)
 
-	for _, p := range fdxFile.Content.Paragraphs {
-		var line lex.Line
-		var contents []string
-		for _, t := range p.Texts {
-			contents = append(contents, t.Content)
+	var title, revisions, out []lex.Line
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	contentDepth := -1
+	hasRoot := false
+	for {
+		offset := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			if !hasRoot {
+				return nil, lex.Errorf(src.point(offset), "no <FinalDraft> element found")
+			}
+			return slices.Concat(title, revisions, out), nil
 		}
-		fullContent := strings.Join(contents, "")
-
-		// Map FDX types to internal lex types
-		switch p.Type {
-		case FDXSceneHeading:
-			line.Type = lex.TypeScene
-		case FDXAction, FDXGeneral:
-			if fullContent == "" {
-				line.Type = lex.TypeEmpty
-			} else {
-				line.Type = lex.TypeAction
+		if err != nil {
+			return slices.Concat(title, revisions, out), src.error(decoder.InputOffset(), err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1 && t.Name.Local != "FinalDraft":
+				return nil, lex.Errorf(src.span(offset, decoder.InputOffset()),
+					"not a Final Draft document, the root element is <%s> instead of <FinalDraft>", t.Name.Local)
+			case depth == 1:
+				hasRoot = true
+			case t.Name.Local == "TitlePage" && contentDepth < 0:
+				var tp FdxTitlePage
+				if err := decoder.DecodeElement(&tp, &t); err != nil {
+					return slices.Concat(title, revisions, out), src.error(decoder.InputOffset(), err)
+				}
+				depth--
+				title = titlePageLines(tp.Content.Paragraphs, src.span(offset, decoder.InputOffset()))
+			case t.Name.Local == "Revisions" && contentDepth < 0:
+				var r FdxRevisions
+				if err := decoder.DecodeElement(&r, &t); err != nil {
+					return slices.Concat(title, revisions, out), src.error(decoder.InputOffset(), err)
+				}
+				depth--
+				revisions = revisionLines(r, src.span(offset, decoder.InputOffset()))
+			case t.Name.Local == "Content" && contentDepth < 0:
+				contentDepth = depth
+			case t.Name.Local == "Paragraph" && contentDepth >= 0:
+				var p FdxParagraph
+				if err := decoder.DecodeElement(&p, &t); err != nil {
+					return slices.Concat(title, revisions, out), src.error(decoder.InputOffset(), err)
+				}
+				depth--
+				pos := src.span(offset, decoder.InputOffset())
+				if p.DualDialogue != nil {
+					out = append(out, dualDialogueLines(*p.DualDialogue, pos)...)
+				} else {
+					out = append(out, paragraphLines(p, pos)...)
+				}
+			}
+		case xml.EndElement:
+			if depth == contentDepth {
+				contentDepth = -1
 			}
-		case FDXCharacter:
-			line.Type = lex.TypeSpeaker
-		case FDXParenthetical:
-			line.Type = lex.TypeParen
-		case FDXDialogue:
-			line.Type = lex.TypeDialog
-		case FDXTransition:
-			line.Type = lex.TypeTrans
-		default:
-			// If we don't recognize the type, treat it as a generic action.
+			depth--
+		}
+	}
+}
+
+// paragraphLines returns the lex line for a paragraph followed by the synopses of its
+// summary, each after a blank line like in Fountain, and its script notes.
+func paragraphLines(p FdxParagraph, pos lex.Position) []lex.Line {
+	line := paragraphToLine(p)
+	line.Pos = pos
+	lines := []lex.Line{line}
+	if p.SceneProperties != nil && p.SceneProperties.Summary != nil {
+		for _, summary := range p.SceneProperties.Summary.Paragraphs {
+			lines = append(lines,
+				lex.Line{Type: lex.TypeEmpty, Pos: pos},
+				lex.Line{Type: "synopse", Contents: paragraphText(summary), Pos: pos})
+		}
+	}
+	for _, note := range p.ScriptNotes {
+		lines = append(lines, lex.Line{Type: lex.TypeNote, Contents: note.text(), Pos: pos})
+	}
+	return lines
+}
+
+// dualDialogueLines wraps the speeches of a dual dialogue block in the dual dialogue markers
+// fountain.Parse produces, so both columns end up the same way as a Fountain ^ pair.
+func dualDialogueLines(d FdxDualDialogue, pos lex.Position) []lex.Line {
+	lines := []lex.Line{{Type: lex.TypeDualOpen, Pos: pos}}
+	speakers := 0
+	for _, p := range d.Paragraphs {
+		if p.Type == FDXCharacter {
+			speakers++
+			if speakers == 2 {
+				lines = append(lines,
+					lex.Line{Type: lex.TypeEmpty, Pos: pos},
+					lex.Line{Type: lex.TypeDualNext, Pos: pos})
+			}
+		}
+		lines = append(lines, paragraphLines(p, pos)...)
+	}
+	return append(lines, lex.Line{Type: lex.TypeEmpty, Pos: pos}, lex.Line{Type: lex.TypeDualClose, Pos: pos})
+}
+
+// paragraphToLine maps a single FDX paragraph to a lex line.
+func paragraphToLine(p FdxParagraph) lex.Line {
+	var line lex.Line
+	fullContent := styledText(p.Texts)
+
+	// Map FDX types to internal lex types
+	switch p.Type {
+	case FDXSceneHeading:
+		line.Type = lex.TypeScene
+		line.SceneNumber = p.Number
+	case FDXAction, FDXGeneral:
+		if synopsis, ok := strings.CutPrefix(fullContent, synopsisPrefix); ok && p.Type == FDXGeneral {
+			line.Type = "synopse"
+			fullContent = synopsis
+		} else if fullContent == "" {
+			line.Type = lex.TypeEmpty
+		} else {
 			line.Type = lex.TypeAction
 		}
+	case FDXCharacter:
+		line.Type = lex.TypeSpeaker
+		fullContent, line.Extensions = lex.SplitExtensions(fullContent)
+	case FDXParenthetical:
+		line.Type = lex.TypeParen
+	case FDXDialogue:
+		line.Type = lex.TypeDialog
+	case FDXTransition:
+		line.Type = lex.TypeTrans
+	default:
+		if level, ok := outlineLevel(p.Type); ok {
+			line.Type = "section"
+			fullContent = strings.Repeat("#", level) + " " + fullContent
+			break
+		}
+		// If we don't recognize the type, treat it as a generic action.
+		line.Type = lex.TypeAction
+	}
+
+	line.Contents = fullContent
+	line.Revision = paragraphRevision(p)
+	return line
+}
+
+// outlineLevel returns the level of an outline element type like "Outline 2"
+func outlineLevel(pType string) (int, bool) {
+	number, ok := strings.CutPrefix(pType, FDXOutline+" ")
+	if !ok {
+		return 0, false
+	}
+	level, err := strconv.Atoi(number)
+	return level, err == nil && level > 0
+}
+
+// paragraphRevision returns the highest revision ID of the text runs of a paragraph
+func paragraphRevision(p FdxParagraph) int {
+	revision := 0
+	for _, t := range p.Texts {
+		if id, err := strconv.Atoi(t.RevisionID); err == nil && id > revision {
+			revision = id
+		}
+	}
+	return revision
+}
 
-		line.Contents = fullContent
-		out = append(out, line)
+// revisionLines declares the revision sets of a script in the screenplay.
+// The original text, revision set 0, isn't a revision and is left out.
+func revisionLines(r FdxRevisions, pos lex.Position) []lex.Line {
+	var lines []lex.Line
+	for _, revision := range r.Revisions {
+		id, err := strconv.Atoi(revision.ID)
+		if err != nil || id <= 0 {
+			continue
+		}
+		lines = append(lines, lex.Line{
+			Type:     lex.TypeRevision,
+			Contents: revision.Name,
+			Revision: id,
+			Color:    revision.Color,
+			Mark:     revision.Mark,
+			Pos:      pos,
+		})
 	}
+	return lines
+}
 
-	return out
+// paragraphText returns the text of all text runs of a paragraph.
+func paragraphText(p FdxParagraph) string {
+	var contents []string
+	for _, t := range p.Texts {
+		contents = append(contents, t.Content)
+	}
+	return strings.Join(contents, "")
+}
+
+// text returns the contents of a script note, one line per paragraph.
+func (n FdxScriptNote) text() string {
+	var lines []string
+	for _, p := range n.Paragraphs {
+		lines = append(lines, paragraphText(p))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// source keeps the raw bytes of an FDX file to translate decoder offsets into positions.
+type source struct {
+	name       string
+	data       []byte
+	lineStarts []int
+}
+
+func newSource(name string, data []byte) *source {
+	lineStarts := []int{0}
+	for i, b := range data {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return &source{name: name, data: data, lineStarts: lineStarts}
+}
+
+// position converts a byte offset into a 1-based line and column.
+func (s *source) position(offset int64) (int, int) {
+	line := sort.Search(len(s.lineStarts), func(i int) bool {
+		return int64(s.lineStarts[i]) > offset
+	})
+	return line, int(offset) - s.lineStarts[line-1] + 1
+}
+
+// span returns the position of an element whose token started after offset start
+// and ended at offset end. Leading whitespace before the element is skipped.
+func (s *source) span(start, end int64) lex.Position {
+	for start < end && start < int64(len(s.data)) && s.data[start] != '<' {
+		start++
+	}
+	line, col := s.position(start)
+	endLine, endCol := s.position(end)
+	return lex.Position{
+		File:    s.name,
+		Line:    line,
+		Col:     col,
+		EndLine: endLine,
+		EndCol:  endCol,
+	}
+}
+
+// point returns the position of a single byte offset
+func (s *source) point(offset int64) lex.Position {
+	line, col := s.position(min(offset, int64(len(s.data))))
+	return lex.Position{File: s.name, Line: line, Col: col, EndLine: line, EndCol: col}
+}
+
+// error returns a ParseError for an XML decoding error that happened at offset.
+// Syntax errors only know their line, so the offset gives the column as well.
+func (s *source) error(offset int64, err error) *lex.ParseError {
+	var syntax *xml.SyntaxError
+	if errors.As(err, &syntax) {
+		return lex.Errorf(s.point(offset), "invalid XML: %s", syntax.Msg)
+	}
+	return &lex.ParseError{Pos: s.point(offset), Err: err}
 }
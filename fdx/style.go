@@ -0,0 +1,81 @@
+package fdx
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/LaPingvino/lexington/lex"
+)
+
+// Emphasis markers in the order they are nested, outermost first
+var emphasisMarkers = []struct {
+	style  string
+	marker string
+}{
+	{"Underline", "_"},
+	{"Bold", "**"},
+	{"Italic", "*"},
+}
+
+// markers returns the Fountain emphasis markers for the style of a text run, outermost first.
+// Final Draft combines styles with a plus, e.g. "Bold+Underline".
+func (t FdxText) markers() []string {
+	styles := map[string]bool{}
+	for _, style := range strings.Split(t.Style, "+") {
+		styles[strings.ToLower(style)] = true
+	}
+	// Earlier versions of the FDXWriter marked italics with AdornmentStyle -1 instead of a style
+	if t.Style == "" && t.AdornmentStyle == "-1" {
+		styles["italic"] = true
+	}
+
+	var markers []string
+	for _, emphasis := range emphasisMarkers {
+		if styles[strings.ToLower(emphasis.style)] {
+			markers = append(markers, emphasis.marker)
+		}
+	}
+	return markers
+}
+
+// styledText joins the text runs of a paragraph, turning bold, italic and underlined runs into
+// Fountain emphasis. Asterisks and underscores in the text itself are escaped. Whitespace at the
+// edges of a styled run is kept outside the markers, as Fountain doesn't allow emphasis to start
+// or end with a space.
+func styledText(texts []FdxText) string {
+	var b strings.Builder
+	var open []string // Markers of the emphasis currently open, outermost first
+	pending := ""     // Whitespace that goes after closing markers
+	for _, t := range texts {
+		core := strings.TrimSpace(t.Content)
+		if core == "" {
+			pending += t.Content
+			continue
+		}
+		lead := t.Content[:strings.IndexFunc(t.Content, func(r rune) bool { return !unicode.IsSpace(r) })]
+		trail := t.Content[len(lead)+len(core):]
+
+		want := t.markers()
+		keep := 0
+		for keep < len(open) && keep < len(want) && open[keep] == want[keep] {
+			keep++
+		}
+		closeMarkers(&b, open[keep:])
+		b.WriteString(pending)
+		b.WriteString(lead)
+		b.WriteString(strings.Join(want[keep:], ""))
+		b.WriteString(lex.EscapeMarkup(core))
+		open = want
+		pending = trail
+	}
+	closeMarkers(&b, open)
+	b.WriteString(pending)
+	return b.String()
+}
+
+// closeMarkers writes the closing markers for open emphasis, innermost first
+func closeMarkers(b *strings.Builder, open []string) {
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString(open[i])
+	}
+}
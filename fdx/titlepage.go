@@ -0,0 +1,121 @@
+package fdx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/LaPingvino/lexington/lex"
+)
+
+// Final Draft title pages have no keys, just aligned text. The title, credit and author
+// are centered, the draft date is right aligned and the contact information left aligned,
+// which is how the title page keys of Fountain are mapped to and from FDX. A centered credit
+// like "written by" is recognized before or after the author. Values spanning multiple
+// lines have a paragraph for every line.
+
+// FdxTitlePage represents the <TitlePage> element, which has its own content.
+type FdxTitlePage struct {
+	Content FdxContent `xml:"Content"`
+}
+
+// titlePageLines converts the paragraphs of a title page to the lines fountain.Parse
+// produces for a title page: the centered keys, a metasection with the other keys and
+// a page break. A title page without text gives no lines.
+func titlePageLines(paragraphs []FdxParagraph, pos lex.Position) []lex.Line {
+	var lines []lex.Line
+	key := ""
+	newBlock := true
+	meta := false
+	for _, p := range paragraphs {
+		text := strings.TrimSpace(styledText(p.Texts))
+		if text == "" {
+			newBlock = true
+			continue
+		}
+
+		switch p.Alignment {
+		case FDXAlignCenter:
+			switch {
+			case isCredit(text) && (key == "" || key == lex.KeyTitle || key == lex.KeyAuthor):
+				key = lex.KeyCredit
+			case newBlock || key == lex.KeyCredit:
+				key = nextCenteredKey(key, lines)
+			}
+		case FDXAlignRight:
+			key = lex.KeyDraftDate
+		default:
+			key = lex.KeyContact
+		}
+		if !newBlock && len(lines) > 0 && lines[len(lines)-1].Type == key {
+			lines[len(lines)-1].Contents += "\n" + text
+			continue
+		}
+		newBlock = false
+
+		if !meta && key != lex.KeyTitle && key != lex.KeyCredit && key != lex.KeyAuthor {
+			meta = true
+			lines = append(lines, lex.Line{Type: lex.TypeMetaSection, Pos: pos})
+		}
+		lines = append(lines, lex.Line{Type: key, Contents: text, Pos: pos})
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	lines = append([]lex.Line{{Type: lex.TypeTitlePage, Pos: pos}}, lines...)
+	return append(lines, lex.Line{Type: lex.TypeNewPage, Pos: pos})
+}
+
+// nextCenteredKey returns the key of a block of centered text following a block with the given key.
+// A credit is followed by the author, unless it came after the author already.
+func nextCenteredKey(key string, lines []lex.Line) string {
+	switch key {
+	case "":
+		return lex.KeyTitle
+	case lex.KeyTitle, lex.KeyCredit:
+		if slices.ContainsFunc(lines, func(line lex.Line) bool { return line.Type == lex.KeyAuthor }) {
+			return lex.KeySource
+		}
+		return lex.KeyAuthor
+	default:
+		return lex.KeySource
+	}
+}
+
+// isCredit returns true for centered text like "written by" that introduces the author
+func isCredit(text string) bool {
+	lower := strings.ToLower(text)
+	return lower == "by" || strings.HasSuffix(lower, " by")
+}
+
+// titlePageParagraphs converts title page lines to FDX paragraphs. Keys are separated
+// by an empty paragraph. Keys at the bottom left other than the contact information are
+// written as "Key: value", as FDX has no other way to tell them apart.
+func titlePageParagraphs(lines []lex.Line) []FdxParagraph {
+	var paragraphs []FdxParagraph
+	for _, line := range lex.Screenplay(lines).TitlePage() {
+		alignment := FDXAlignLeft
+		text := line.Contents
+		switch lex.TitlePlacement(line.Type) {
+		case lex.TitleCenter:
+			alignment = FDXAlignCenter
+		case lex.TitleRight:
+			alignment = FDXAlignRight
+		default:
+			if !strings.EqualFold(line.Type, lex.KeyContact) {
+				text = fmt.Sprintf("%s: %s", line.Type, line.Contents)
+			}
+		}
+
+		if len(paragraphs) > 0 {
+			paragraphs = append(paragraphs, FdxParagraph{Alignment: alignment, Texts: []FdxText{{}}})
+		}
+		for _, row := range strings.Split(text, "\n") {
+			paragraphs = append(paragraphs, FdxParagraph{
+				Alignment: alignment,
+				Texts:     processInlineMarkup(row),
+			})
+		}
+	}
+	return paragraphs
+}
@@ -5,229 +5,411 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"regexp"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/LaPingvino/lexington/lex"
-)
-
-// Inline markup patterns for FDX output
-var (
-	bolditalic = regexp.MustCompile(`\*{3}([^\*\n]+)\*{3}`)
-	bold       = regexp.MustCompile(`\*{2}([^\*\n]+)\*{2}`)
-	italic     = regexp.MustCompile(`\*{1}([^\*\n]+)\*{1}`)
-	underline  = regexp.MustCompile(`_{1}([^\*\n]+)_{1}`)
+	"github.com/LaPingvino/lexington/rules"
 )
 
 // FDXWriter implements the writer.Writer interface for FDX output.
+// By default the document is generated with encoding/xml, a custom text/template can be used instead.
 type FDXWriter struct {
-	TemplatePath string // Path to a custom FDX template file
-}
-
-const defaultFDXTemplate = `<?xml version="1.0" encoding="UTF-8"?>
-<FinalDraft Version="1.0">
-  <Content>
-{{range .Paragraphs}}    <Paragraph Type="{{.Type}}">
-{{range .Texts}}      <Text` +
-	`{{if .AdornmentStyle}} AdornmentStyle="{{.AdornmentStyle}}"{{end}}` +
-	`{{if .Background}} Background="{{.Background}}"{{end}}` +
-	`{{if .Color}} Color="{{.Color}}"{{end}}` +
-	`{{if .Font}} Font="{{.Font}}"{{end}}` +
-	`{{if .RevisionID}} RevisionID="{{.RevisionID}}"{{end}}` +
-	`{{if .Size}} Size="{{.Size}}"{{end}}` +
-	`{{if .Style}} Style="{{.Style}}"{{end}}>{{.Content}}</Text>
-{{end}}    </Paragraph>
-{{end}}  </Content>
-</FinalDraft>
-`
-
-// markupMatch represents a found markup pattern
-type markupMatch struct {
-	start      int
-	end        int
-	markupType string
-}
-
-// findEarliestMarkup finds the earliest markup pattern in the text
-func findEarliestMarkup(text string) *markupMatch {
-	var earliest *markupMatch
-
-	patterns := map[string]*regexp.Regexp{
-		"bolditalic": bolditalic,
-		"bold":       bold,
-		"italic":     italic,
-		"underline":  underline,
-	}
-
-	for markupType, pattern := range patterns {
-		if match := pattern.FindStringIndex(text); match != nil {
-			if earliest == nil || match[0] < earliest.start {
-				earliest = &markupMatch{
-					start:      match[0],
-					end:        match[1],
-					markupType: markupType,
-				}
-			}
+	TemplatePath string    // Path to a custom FDX template file, see templateData for what it gets
+	Elements     rules.Set // Hidden notes become ScriptNotes, shown ones General paragraphs
+}
+
+// templateData is passed to a custom FDX template. The paragraphs of the content are available
+// as .Paragraphs, the paragraphs of the title page as .TitlePage and the revision sets as .Revisions.
+// Text is already escaped for XML, so {{.Content}} can be written as it is. The escapeXML function
+// is only meant for text the template adds itself: applied to this data it escapes the text twice.
+type templateData struct {
+	FdxContent
+	TitlePage []FdxParagraph
+	Revisions *FdxRevisions
+}
+
+// fdxStyles are the Final Draft names of the emphasis styles, in the order they are combined
+var fdxStyles = []struct {
+	style lex.Style
+	name  string
+}{
+	{lex.Bold, "Bold"},
+	{lex.Italic, "Italic"},
+	{lex.Underline, "Underline"},
+}
+
+// createStyledText creates an FdxText with the styling of a run of text
+func createStyledText(run lex.Run) FdxText {
+	if run.Style == 0 {
+		return FdxText{Content: run.Text}
+	}
+	var names []string
+	for _, s := range fdxStyles {
+		if run.Style.Has(s.style) {
+			names = append(names, s.name)
 		}
 	}
+	return FdxText{
+		Content:        run.Text,
+		AdornmentStyle: "0",
+		Background:     "#FFFFFFFFFFFF",
+		Color:          "#000000000000",
+		Font:           "Courier",
+		RevisionID:     "0",
+		Size:           "12",
+		Style:          strings.Join(names, "+"),
+	}
+}
+
+// processInlineMarkup converts fountain-style inline markup to FDX Text elements
+func processInlineMarkup(text string) []FdxText {
+	var result []FdxText
+	for _, run := range lex.MarkupRuns(text) {
+		result = append(result, createStyledText(run))
+	}
+	if result == nil {
+		return []FdxText{{Content: text}}
+	}
+	return result
+}
 
-	return earliest
+// fdxState holds the state needed while converting a screenplay to FDX
+type fdxState struct {
+	file          FdxFile
+	elements      rules.Set
+	noteCount     int
+	dual          *FdxDualDialogue // Speeches of the dual dialogue being collected, nil outside of one
+	afterSynopsis bool             // The previous line was a synopsis
 }
 
-// createStyledText creates an FdxText with the appropriate styling
-func createStyledText(content, markupType string) FdxText {
-	baseText := FdxText{
-		Content:    escapeXML(content),
-		Background: "#FFFFFFFFFFFF",
-		Color:      "#000000000000",
-		Font:       "Courier",
-		RevisionID: "0",
-		Size:       "12",
+// Write converts the internal lex.Screenplay format to an FDX XML file.
+// It implements the writer.Writer interface.
+func (f *FDXWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
+	state := &fdxState{elements: f.Elements}
+	if state.elements == nil {
+		state.elements = rules.Default
 	}
 
-	switch markupType {
-	case "bolditalic", "bold":
-		baseText.AdornmentStyle = "0"
-		baseText.Style = "Bold"
-	case "italic":
-		baseText.AdornmentStyle = "-1"
-		baseText.Style = ""
-	case "underline":
-		baseText.AdornmentStyle = "0"
-		baseText.Style = "Underline"
+	screenplay, titlePage := screenplay.SplitTitlePage()
+	if len(titlePage) > 0 {
+		state.file.TitlePage = &FdxTitlePage{Content: FdxContent{Paragraphs: titlePageParagraphs(titlePage)}}
+	}
+	for _, line := range screenplay {
+		state.addLine(line)
+	}
+	state.closeDual()
+
+	if f.TemplatePath != "" {
+		return f.executeTemplate(w, state.file)
 	}
 
-	return baseText
+	state.file.Version = fdxVersion
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(state.file); err != nil {
+		return fmt.Errorf("failed to write FDX: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
 }
 
-// extractContent extracts the content from markup based on type
-func extractContent(text, markupType string) string {
-	switch markupType {
-	case "bolditalic":
-		return bolditalic.FindStringSubmatch(text)[1]
-	case "bold":
-		return bold.FindStringSubmatch(text)[1]
-	case "italic":
-		return italic.FindStringSubmatch(text)[1]
-	case "underline":
-		return underline.FindStringSubmatch(text)[1]
-	default:
-		return ""
+// executeTemplate writes the FDX file using the custom template
+func (f *FDXWriter) executeTemplate(w io.Writer, file FdxFile) error {
+	tmpl, err := template.New(filepath.Base(f.TemplatePath)).
+		Funcs(template.FuncMap{"escapeXML": escapeXML}).
+		ParseFiles(f.TemplatePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse FDX template file %s: %w", f.TemplatePath, err)
+	}
+
+	// The content is embedded, so templates can range over .Paragraphs directly
+	data := templateData{
+		FdxContent: FdxContent{Paragraphs: escapeParagraphs(file.Content.Paragraphs)},
+		Revisions:  escapeRevisions(file.Revisions),
 	}
+	if file.TitlePage != nil {
+		data.TitlePage = escapeParagraphs(file.TitlePage.Content.Paragraphs)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		return fmt.Errorf("failed to execute FDX template file %s: %w", f.TemplatePath, err)
+	}
+	return nil
 }
 
-// processInlineMarkup converts fountain-style inline markup to FDX Text elements
-func processInlineMarkup(text string) []FdxText {
-	if !strings.ContainsAny(text, "*_") {
-		return []FdxText{{Content: escapeXML(text)}}
+// paragraphs returns the paragraphs new lines are added to: those of the dual dialogue
+// being collected, or the content.
+func (s *fdxState) paragraphs() *[]FdxParagraph {
+	if s.dual != nil {
+		return &s.dual.Paragraphs
 	}
+	return &s.file.Content.Paragraphs
+}
 
-	var result []FdxText
-	remaining := text
+// closeDual adds the dual dialogue being collected to the content
+func (s *fdxState) closeDual() {
+	if s.dual != nil {
+		s.file.Content.Paragraphs = append(s.file.Content.Paragraphs, FdxParagraph{DualDialogue: s.dual})
+		s.dual = nil
+	}
+}
 
-	for len(remaining) > 0 {
-		match := findEarliestMarkup(remaining)
-		if match == nil {
-			if len(remaining) > 0 {
-				result = append(result, FdxText{Content: escapeXML(remaining)})
-			}
-			break
+// addLine converts a single lex line into FDX
+func (s *fdxState) addLine(line lex.Line) {
+	// The blank line following a synopsis goes into the scene properties together with it
+	if s.afterSynopsis && line.Type == lex.TypeEmpty {
+		s.afterSynopsis = false
+		return
+	}
+	s.afterSynopsis = false
+
+	// Hidden notes are attached to the previous paragraph as non-printing
+	// script notes, hidden boneyard has no FDX equivalent and is dropped.
+	if line.IsAnnotation() && s.elements.Get(line.Type).Hide {
+		if line.Type == lex.TypeNote {
+			s.noteCount++
+			*s.paragraphs() = attachScriptNote(*s.paragraphs(), s.noteCount, line.Contents)
 		}
+		return
+	}
+
+	if s.addStructure(line) {
+		return
+	}
 
-		// Add text before the markup as normal text
-		if match.start > 0 {
-			result = append(result, FdxText{Content: escapeXML(remaining[:match.start])})
+	contents := line.Contents
+	var pType string
+	switch line.Type {
+	case lex.TypeEmpty:
+		// An empty line in Fountain is often an empty Action paragraph in FDX.
+		// Dual dialogue only holds the speeches themselves.
+		if s.dual != nil {
+			return
 		}
+		pType = FDXAction
+	case "section":
+		pType, contents = outlineElement(line.Contents)
+	default:
+		pType = paragraphType(line.Type)
+	}
+
+	// Process inline markup to create multiple text elements
+	texts := processInlineMarkup(contents)
+	if line.Type == lex.TypeSpeaker {
+		texts = s.addSpeaker(line, texts)
+	}
+	if line.Revision > 0 {
+		for i := range texts {
+			texts[i].RevisionID = strconv.Itoa(line.Revision)
+		}
+	}
 
-		// Extract content and create styled text
-		matchedText := remaining[match.start:match.end]
-		content := extractContent(matchedText, match.markupType)
-		styledText := createStyledText(content, match.markupType)
-		result = append(result, styledText)
+	*s.paragraphs() = append(*s.paragraphs(), FdxParagraph{
+		Type:   pType,
+		Number: line.SceneNumber,
+		Texts:  texts,
+	})
+}
 
-		// Move to the text after this markup
-		remaining = remaining[match.end:]
+// addSpeaker adds the character extensions of a speaker as text runs of their own,
+// like Final Draft does, and lists the name and extensions for SmartType.
+func (s *fdxState) addSpeaker(line lex.Line, texts []FdxText) []FdxText {
+	if s.file.SmartType == nil {
+		s.file.SmartType = &FdxSmartType{}
+	}
+	smartType := s.file.SmartType
+	if name := strings.ToUpper(line.Contents); !slices.Contains(smartType.Characters, name) {
+		smartType.Characters = append(smartType.Characters, name)
+	}
+	for _, ext := range line.Extensions {
+		if listed := "(" + strings.ToUpper(ext) + ")"; !slices.Contains(smartType.Extensions, listed) {
+			smartType.Extensions = append(smartType.Extensions, listed)
+		}
+		texts = append(texts, FdxText{Content: " (" + ext + ")"})
 	}
+	return texts
+}
 
-	return result
+// addStructure handles lex types that don't become a paragraph of their own.
+// It returns false for all other types.
+func (s *fdxState) addStructure(line lex.Line) bool {
+	switch line.Type {
+	case "newpage":
+		// Page breaks aren't kept in FDX
+	case "synopse":
+		s.addSynopsis(line.Contents)
+	case lex.TypeDualOpen:
+		s.closeDual()
+		s.dual = &FdxDualDialogue{}
+	case lex.TypeDualNext:
+		// The second Character paragraph starts the right column
+	case lex.TypeDualClose:
+		s.closeDual()
+	case lex.TypeRevision:
+		s.file.Revisions = addRevision(s.file.Revisions, line)
+	default:
+		return false
+	}
+	return true
 }
 
-// Write converts the internal lex.Screenplay format to an FDX XML file.
-// It implements the writer.Writer interface.
-func (f *FDXWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
-	var fdxFile FdxFile
+// paragraphType maps internal lex types to FDX Paragraph types
+func paragraphType(lineType string) string {
+	switch lineType {
+	case lex.TypeScene:
+		return FDXSceneHeading
+	case lex.TypeAction, lex.TypeCenter: // Assuming 'center' can be treated as 'Action' for FDX export
+		return FDXAction
+	case lex.TypeSpeaker:
+		return FDXCharacter
+	case lex.TypeParen:
+		return FDXParenthetical
+	case lex.TypeDialog, lex.TypeLyrics:
+		return FDXDialogue
+	case lex.TypeTrans:
+		return FDXTransition
+	default:
+		// Use "General" as a fallback for any unrecognized types.
+		return FDXGeneral
+	}
+}
 
-	for _, line := range screenplay {
-		// Skip structural lex types that don't directly map to FDX paragraphs
-		switch line.Type {
-		case "titlepage", "metasection", "newpage", "section", "synopse":
-			continue
-		}
+// outlineElement returns the outline paragraph type and text for a section heading.
+// The number of # characters gives the level, "## Meeting" becomes an Outline 2 paragraph.
+func outlineElement(section string) (string, string) {
+	text := strings.TrimLeft(section, "#")
+	level := max(len(section)-len(text), 1)
+	return fmt.Sprintf("%s %d", FDXOutline, level), strings.TrimSpace(text)
+}
 
-		var pType string
-		// Map internal lex types to FDX Paragraph types.
-		switch line.Type {
-		case lex.TypeScene:
-			pType = FDXSceneHeading
-		case lex.TypeAction, lex.TypeCenter: // Assuming 'center' can be treated as 'Action' for FDX export
-			pType = FDXAction
-		case lex.TypeEmpty:
-			// An empty line in Fountain is often an empty Action paragraph in FDX.
-			pType = FDXAction
-		case lex.TypeSpeaker:
-			pType = FDXCharacter
-		case lex.TypeParen:
-			pType = FDXParenthetical
-		case lex.TypeDialog, lex.TypeLyrics:
-			pType = FDXDialogue
-		case lex.TypeTrans:
-			pType = FDXTransition
-		case lex.TypeDualOpen, lex.TypeDualNext, lex.TypeDualClose:
-			// Dual dialogue is complex in FDX and might require a more sophisticated
-			// transformation than a simple text template can provide.
-			// For this basic template, we'll skip these markers for now,
-			// or treat them as actions/general text if content is present.
-			// A full FDX dual dialogue implementation would involve nested structures.
-			continue
-		default:
-			// Use "General" as a fallback for any unrecognized types.
-			pType = FDXGeneral
-		}
+// addSynopsis adds a synopsis to the summary of the scene heading or outline element it follows.
+// Any other synopsis stays in place as a General paragraph starting with "= " like in Fountain.
+func (s *fdxState) addSynopsis(contents string) {
+	paragraphs := s.file.Content.Paragraphs
+	i := len(paragraphs) - 1
+	// Blank lines may come in between, they are empty Action paragraphs
+	for i >= 0 && paragraphs[i].Type == FDXAction && paragraphText(paragraphs[i]) == "" {
+		i--
+	}
+	if i < 0 || s.dual != nil || !isSummarized(paragraphs[i]) {
+		*s.paragraphs() = append(*s.paragraphs(), FdxParagraph{
+			Type:  FDXGeneral,
+			Texts: []FdxText{{Content: synopsisPrefix + contents}},
+		})
+		return
+	}
 
-		// Process inline markup to create multiple text elements
-		texts := processInlineMarkup(line.Contents)
+	p := &paragraphs[i]
+	if p.SceneProperties == nil {
+		p.SceneProperties = &FdxSceneProperties{}
+	}
+	if p.SceneProperties.Summary == nil {
+		p.SceneProperties.Summary = &FdxSummary{}
+	}
+	p.SceneProperties.Summary.Paragraphs = append(p.SceneProperties.Summary.Paragraphs,
+		FdxParagraph{Texts: []FdxText{{Content: contents}}})
+	s.afterSynopsis = true
+}
 
-		paragraph := FdxParagraph{
-			Type:  pType,
-			Texts: texts,
-		}
+// isSummarized reports if a paragraph can hold a summary, which scene headings and outline elements can
+func isSummarized(p FdxParagraph) bool {
+	_, ok := outlineLevel(p.Type)
+	return ok || p.Type == FDXSceneHeading
+}
 
-		fdxFile.Content.Paragraphs = append(fdxFile.Content.Paragraphs, paragraph)
+// addRevision adds a revision set to the list of revisions, which is created for the first set.
+// The set with the highest ID becomes the active one. Sets without a mark get an asterisk.
+func addRevision(revisions *FdxRevisions, line lex.Line) *FdxRevisions {
+	if revisions == nil {
+		revisions = &FdxRevisions{}
+	}
+	if active, _ := strconv.Atoi(revisions.ActiveSet); line.Revision > active {
+		revisions.ActiveSet = strconv.Itoa(line.Revision)
 	}
+	mark := line.Mark
+	if mark == "" {
+		mark = "*"
+	}
+	revisions.Revisions = append(revisions.Revisions, FdxRevision{
+		ID:    strconv.Itoa(line.Revision),
+		Name:  line.Contents,
+		Color: line.Color,
+		Mark:  mark,
+	})
+	return revisions
+}
 
-	var tmpl *template.Template
-	var err error
+// attachScriptNote adds a note to the last paragraph, creating an empty one if there is none yet.
+func attachScriptNote(paragraphs []FdxParagraph, id int, contents string) []FdxParagraph {
+	if len(paragraphs) == 0 {
+		paragraphs = append(paragraphs, FdxParagraph{Type: FDXAction})
+	}
+	note := FdxScriptNote{ID: strconv.Itoa(id)}
+	for _, text := range strings.Split(contents, "\n") {
+		note.Paragraphs = append(note.Paragraphs, FdxParagraph{Texts: []FdxText{{Content: text}}})
+	}
+	last := &paragraphs[len(paragraphs)-1]
+	last.ScriptNotes = append(last.ScriptNotes, note)
+	return paragraphs
+}
 
-	if f.TemplatePath != "" {
-		tmpl, err = template.ParseFiles(f.TemplatePath)
-		if err != nil {
-			return fmt.Errorf("failed to parse FDX template file %s: %w", f.TemplatePath, err)
+// escapeParagraphs returns a copy of the paragraphs with their text escaped for custom templates
+func escapeParagraphs(paragraphs []FdxParagraph) []FdxParagraph {
+	if paragraphs == nil {
+		return nil
+	}
+	escaped := make([]FdxParagraph, len(paragraphs))
+	for i, p := range paragraphs {
+		p.Number = escapeXML(p.Number)
+		if p.SceneProperties != nil {
+			properties := *p.SceneProperties
+			properties.Title = escapeXML(properties.Title)
+			if properties.Summary != nil {
+				properties.Summary = &FdxSummary{Paragraphs: escapeParagraphs(properties.Summary.Paragraphs)}
+			}
+			p.SceneProperties = &properties
 		}
-	} else {
-		tmpl, err = template.New("fdxScreenplay").Parse(defaultFDXTemplate)
-		if err != nil {
-			return fmt.Errorf("failed to parse default FDX template: %w", err)
+		if p.ScriptNotes != nil {
+			notes := make([]FdxScriptNote, len(p.ScriptNotes))
+			for j, note := range p.ScriptNotes {
+				notes[j] = FdxScriptNote{ID: note.ID, Paragraphs: escapeParagraphs(note.Paragraphs)}
+			}
+			p.ScriptNotes = notes
 		}
+		if p.DualDialogue != nil {
+			p.DualDialogue = &FdxDualDialogue{Paragraphs: escapeParagraphs(p.DualDialogue.Paragraphs)}
+		}
+		texts := make([]FdxText, len(p.Texts))
+		for j, text := range p.Texts {
+			text.Content = escapeXML(text.Content)
+			texts[j] = text
+		}
+		p.Texts = texts
+		escaped[i] = p
 	}
+	return escaped
+}
 
-	// Execute the template with the constructed FdxFile data.
-	// We need to pass fdxFile.Content as the top-level data for the template
-	// because the template expects a slice of Paragraphs.
-	return tmpl.Execute(w, fdxFile.Content)
+// escapeRevisions returns a copy of the revision sets with their names escaped for custom templates
+func escapeRevisions(revisions *FdxRevisions) *FdxRevisions {
+	if revisions == nil {
+		return nil
+	}
+	escaped := &FdxRevisions{ActiveSet: revisions.ActiveSet}
+	for _, revision := range revisions.Revisions {
+		revision.Name = escapeXML(revision.Name)
+		escaped.Revisions = append(escaped.Revisions, revision)
+	}
+	return escaped
 }
 
-// escapeXML escapes characters that have special meaning in XML.
+// escapeXML escapes characters that have special meaning in XML
 func escapeXML(s string) string {
 	var b bytes.Buffer
 	if err := xml.EscapeText(&b, []byte(s)); err != nil {
@@ -25,10 +25,8 @@ func GetFont(name, style string) []byte {
 	switch name {
 	case CourierBadiName, CourierPrimeName, CourierName, "":
 		switch style {
-		case "I", "i":
-			return CourierBadiItalic
-		case "B", "b", "BI", "bi":
-			return CourierBadiRegular // Using regular for bold since we only have regular and italic
+		case "I", "i", "BI", "bi", "IB", "ib":
+			return CourierBadiItalic // No bold face is embedded, PDF output synthesizes it
 		default:
 			return CourierBadiRegular
 		}
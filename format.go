@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/LaPingvino/lexington/fountain"
+	"github.com/LaPingvino/lexington/rules"
+)
+
+// FormatConfig holds the command-line configuration of the fmt command
+type FormatConfig struct {
+	ConfigFile string
+	Scenes     string
+	Check      bool
+	Force      bool
+	Files      []string
+}
+
+// errUnformatted is returned by the fmt command with -check if a file isn't formatted
+var errUnformatted = errors.New("not all files are formatted")
+
+// runFormat formats Fountain files in place, or standard input to standard output if no files are given.
+// With -check nothing is written and the files that aren't formatted are listed instead.
+func runFormat(args []string) error {
+	config, err := parseFormatFlags(args)
+	if err != nil {
+		return err
+	}
+	scenes := rules.GetConf(config.ConfigFile).Scenes[config.Scenes]
+
+	if len(config.Files) == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		formatted, err := formatFountain(source, scenes, config.Force)
+		if err != nil {
+			return fmt.Errorf("error parsing standard input:\n%w", err)
+		}
+		if config.Check {
+			if !bytes.Equal(source, formatted) {
+				return errUnformatted
+			}
+			return nil
+		}
+		_, err = os.Stdout.Write(formatted)
+		return err
+	}
+
+	unformatted := false
+	for _, file := range config.Files {
+		changed, err := formatFile(file, scenes, config)
+		if err != nil {
+			return err
+		}
+		if changed && config.Check {
+			fmt.Println(file)
+			unformatted = true
+		}
+	}
+	if unformatted {
+		return errUnformatted
+	}
+	return nil
+}
+
+func parseFormatFlags(args []string) (*FormatConfig, error) {
+	config := &FormatConfig{}
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: lexington fmt [flags] [file.fountain ...]")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&config.ConfigFile, "config", "lexington.toml", "Configuration file to use.")
+	flags.StringVar(&config.Scenes, "scenes", "en", "Configuration to use for scene header detection.")
+	flags.BoolVar(&config.Check, "check", false,
+		"List the files that aren't formatted and exit non-zero if there are any, without changing them.")
+	flags.BoolVar(&config.Force, "force", false,
+		"Force every scene heading, transition, character and action, instead of only where it is needed.")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	config.Files = flags.Args()
+	return config, nil
+}
+
+// formatFile formats a Fountain file in place and returns true if it wasn't formatted yet.
+// With -check the file is left as it is.
+func formatFile(file string, scenes []string, config *FormatConfig) (bool, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	formatted, err := formatFountain(source, scenes, config.Force)
+	if err != nil {
+		return false, fmt.Errorf("error parsing %s:\n%w", file, err)
+	}
+	if bytes.Equal(source, formatted) {
+		return false, nil
+	}
+	if !config.Check {
+		log.Printf("Formatting %s", file)
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(file, formatted, info.Mode()); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// formatFountain returns the formatted version of a Fountain source
+func formatFountain(source []byte, scenes []string, force bool) ([]byte, error) {
+	screenplay, err := fountain.Parse(scenes, bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	writer := &fountain.FountainWriter{SceneConfig: scenes, AlignTitle: true, ForceAll: force}
+	if err := writer.Write(&buffer, fountain.Format(screenplay)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,180 @@
+package fountain
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/LaPingvino/lexington/lex"
+)
+
+// Delimiters for notes and boneyard blocks. Both may span several rows.
+const (
+	noteOpen      = "[["
+	noteClose     = "]]"
+	boneyardOpen  = "/*"
+	boneyardClose = "*/"
+)
+
+// sourceRow is a row of the Fountain source with notes and boneyard removed.
+// The removed parts are kept as separate lex lines in annotations.
+type sourceRow struct {
+	text        string
+	annotations []lex.Line
+	offsets     []int // Byte offsets in text where the annotations starting on the row were
+	onlyHidden  bool  // Everything on the row belongs to a note or boneyard
+}
+
+// annotationSpan is a note or boneyard block found in the source.
+type annotationSpan struct {
+	start, end int // Byte offsets of the delimiters, end is exclusive
+	line       lex.Line
+}
+
+// extractAnnotations finds all [[notes]] and /* boneyard */ blocks in the rows and
+// strips them from the row texts. Each block is attached to the row it starts on.
+// Unterminated blocks are left alone and parsed as regular text.
+func extractAnnotations(file string, rows []string) []sourceRow {
+	text := strings.Join(rows, "")
+	rowStarts := make([]int, len(rows))
+	offset := 0
+	for i, row := range rows {
+		rowStarts[i] = offset
+		offset += len(row)
+	}
+	rowOf := func(offset int) int {
+		return sort.Search(len(rowStarts), func(i int) bool { return rowStarts[i] > offset }) - 1
+	}
+	posOf := func(offset int) (int, int) {
+		row := rowOf(offset)
+		return row + 1, offset - rowStarts[row] + 1
+	}
+
+	spans := findAnnotationSpans(text)
+
+	result := make([]sourceRow, len(rows))
+	for i, row := range rows {
+		result[i].text = row
+	}
+	if len(spans) == 0 {
+		return result
+	}
+
+	for i := range spans {
+		line, col := posOf(spans[i].start)
+		endLine, endCol := posOf(spans[i].end - 1)
+		spans[i].line.Pos = lex.Position{File: file, Line: line, Col: col, EndLine: endLine, EndCol: endCol + 1}
+		first := rowOf(spans[i].start)
+		result[first].annotations = append(result[first].annotations, spans[i].line)
+	}
+
+	next := 0
+	for i, row := range rows {
+		var b strings.Builder
+		covered := false
+		rowEnd := rowStarts[i] + len(row)
+		for j := rowStarts[i]; j < rowEnd; j++ {
+			if next < len(spans) && spans[next].start == j {
+				result[i].offsets = append(result[i].offsets, b.Len())
+				next++
+			}
+			hidden := inSpans(spans, j)
+			covered = covered || hidden
+			if !hidden || text[j] == '\n' || text[j] == '\r' {
+				b.WriteByte(text[j])
+			}
+		}
+		result[i].text = b.String()
+		result[i].onlyHidden = covered && strings.TrimSpace(result[i].text) == ""
+	}
+	return result
+}
+
+// hasInlineText returns true for the elements notes and boneyard can be written inside of
+func hasInlineText(element lex.ElementType) bool {
+	switch element {
+	case lex.TypeAction, lex.TypeDialog, lex.TypeLyrics, lex.TypeSpeaker, lex.TypeParen, lex.TypeScene,
+		lex.TypeTrans, lex.TypeCenter, "synopse", "section":
+		return true
+	default:
+		return false
+	}
+}
+
+// markInline marks the annotations found inside the text of the element parsed from a row as
+// inline, with their offset in the text of that element. Annotations spanning several rows stay on rows of their own.
+func markInline(screenplay lex.Screenplay, row sourceRow, line int) {
+	if len(row.annotations) == 0 || len(screenplay) == 0 {
+		return
+	}
+	owner := screenplay[len(screenplay)-1]
+	if owner.Pos.EndLine != line || !hasInlineText(owner.Type) {
+		return
+	}
+	last := owner.Contents[strings.LastIndex(owner.Contents, "\n")+1:]
+	start := strings.Index(row.text, last)
+	if start < 0 {
+		start = strings.Index(strings.ToUpper(row.text), strings.ToUpper(last))
+	}
+	if start < 0 || last == "" {
+		return
+	}
+	for k := range row.annotations {
+		annotation := &row.annotations[k]
+		if annotation.Pos.EndLine != annotation.Pos.Line {
+			continue
+		}
+		annotation.Inline = true
+		annotation.Offset = len(owner.Contents) - len(last) + min(max(row.offsets[k]-start, 0), len(last))
+	}
+}
+
+// findAnnotationSpans scans the whole source for notes and boneyard blocks in order.
+func findAnnotationSpans(text string) []annotationSpan {
+	var spans []annotationSpan
+	for pos := 0; pos < len(text); {
+		noteAt := indexFrom(text, noteOpen, pos)
+		boneAt := indexFrom(text, boneyardOpen, pos)
+		if noteAt < 0 && boneAt < 0 {
+			break
+		}
+
+		open, closer, elementType := noteOpen, noteClose, lex.TypeNote
+		start := noteAt
+		if noteAt < 0 || (boneAt >= 0 && boneAt < noteAt) {
+			open, closer, elementType = boneyardOpen, boneyardClose, lex.TypeBoneyard
+			start = boneAt
+		}
+
+		end := indexFrom(text, closer, start+len(open))
+		if end < 0 {
+			// Unterminated, treat the delimiter as literal text
+			pos = start + len(open)
+			continue
+		}
+		contents := text[start+len(open) : end]
+		if elementType == lex.TypeNote {
+			contents = strings.TrimSpace(strings.ReplaceAll(contents, "\r", ""))
+		}
+		end += len(closer)
+		spans = append(spans, annotationSpan{
+			start: start,
+			end:   end,
+			line:  lex.Line{Type: elementType, Contents: contents},
+		})
+		pos = end
+	}
+	return spans
+}
+
+func indexFrom(s, substr string, from int) int {
+	i := strings.Index(s[from:], substr)
+	if i < 0 {
+		return -1
+	}
+	return from + i
+}
+
+func inSpans(spans []annotationSpan, offset int) bool {
+	i := sort.Search(len(spans), func(i int) bool { return spans[i].end > offset })
+	return i < len(spans) && spans[i].start <= offset
+}
@@ -0,0 +1,54 @@
+package fountain
+
+import (
+	"strings"
+
+	"github.com/LaPingvino/lexington/lex"
+)
+
+// titleKeys are the standard title page keys by lower case name, in the case they are formatted in
+var titleKeys = map[string]string{
+	"title":      lex.KeyTitle,
+	"credit":     lex.KeyCredit,
+	"author":     lex.KeyAuthor,
+	"authors":    "Authors",
+	"source":     lex.KeySource,
+	"draft date": lex.KeyDraftDate,
+	"date":       "Date",
+	"contact":    lex.KeyContact,
+	"notes":      lex.KeyNotes,
+	"copyright":  lex.KeyCopyright,
+}
+
+// Format returns a copy of the screenplay normalized for formatted Fountain output. Scene headings
+// and transitions are written in capitals, runs of blank lines become a single one, blank lines
+// at the start of the screenplay and right after the title page are left out and the standard
+// title page keys get their usual case. The source text kept by ParsePreserving is dropped,
+// so every element is written anew.
+func Format(screenplay lex.Screenplay) lex.Screenplay {
+	formatted := make(lex.Screenplay, 0, len(screenplay))
+	blank := true // The last written row was blank, or nothing was written yet
+	_, title := screenplay.SplitTitlePage()
+	for i, line := range screenplay {
+		line.Source = nil
+		switch {
+		case i < len(title):
+			if key, ok := titleKeys[strings.ToLower(line.Type)]; ok {
+				line.Type = key
+			}
+		case line.Type == lex.TypeEmpty && blank:
+			continue
+		case line.Type == lex.TypeScene, line.Type == lex.TypeTrans:
+			line.Contents = strings.ToUpper(strings.TrimSpace(line.Contents))
+		}
+		switch {
+		case isWritten(line):
+			blank = line.Type == lex.TypeEmpty || i == len(title)-1
+		case line.IsAnnotation() && !line.Inline:
+			// Notes and boneyard on rows of their own keep the blank row after them
+			blank = false
+		}
+		formatted = append(formatted, line)
+	}
+	return formatted
+}
@@ -2,10 +2,17 @@ package fountain
 
 import (
 	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/quick"
+	"time"
 
 	"github.com/LaPingvino/lexington/lex"
 )
@@ -26,7 +33,7 @@ func TestFountainRoundTrip(t *testing.T) {
 		}
 	}()
 
-	originalScreenplay := Parse(scenes, originalFile)
+	originalScreenplay := mustParse(t, scenes, originalFile).WithoutPositions()
 	if len(originalScreenplay) == 0 {
 		t.Fatal("Parsing the original file resulted in an empty screenplay.")
 	}
@@ -43,7 +50,7 @@ func TestFountainRoundTrip(t *testing.T) {
 	}
 
 	// 3. Parse the content that was just written to the buffer.
-	roundTripScreenplay := Parse(scenes, &buffer)
+	roundTripScreenplay := mustParse(t, scenes, &buffer).WithoutPositions()
 	if len(roundTripScreenplay) == 0 {
 		t.Fatal("Parsing the round-tripped file resulted in an empty screenplay.")
 	}
@@ -64,6 +71,74 @@ func TestFountainRoundTrip(t *testing.T) {
 	}
 }
 
+var update = flag.Bool("update", false, "Write the expected lex files of TestConformance")
+
+var seed = flag.Int64("seed", 0, "Seed of the property-based tests, a new one is picked if 0")
+
+// quickConfig returns the configuration of a property-based test. The seed is logged so
+// a failure can be repeated with -seed.
+func quickConfig(t *testing.T) *quick.Config {
+	t.Helper()
+	s := *seed
+	if s == 0 {
+		s = time.Now().UnixNano()
+	}
+	t.Logf("Seed %d", s)
+	return &quick.Config{MaxCount: 1000, Rand: rand.New(rand.NewSource(s))}
+}
+
+// TestConformance parses every Fountain file in testdata/input and compares the result in the
+// lex format with the file of the same name in testdata/expected. Run with -update after
+// checking that changes to the output are right.
+func TestConformance(t *testing.T) {
+	scenes := []string{"INT", "EXT", "EST", "INT./EXT", "INT/EXT", "EXT/INT", "EXT./INT", "I/E"}
+	inputs, err := filepath.Glob("../testdata/input/*.fountain")
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("No Fountain files found in testdata/input: %v", err)
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".fountain")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", input, err)
+			}
+			screenplay := mustParse(t, scenes, bytes.NewReader(data)).WithoutPositions()
+			var got bytes.Buffer
+			if err := (&lex.LexWriter{}).Write(&got, screenplay); err != nil {
+				t.Fatalf("LexWriter.Write returned an unexpected error: %v", err)
+			}
+
+			expectedPath := filepath.Join("..", "testdata", "expected", name+".lex")
+			if *update {
+				if err := os.WriteFile(expectedPath, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(expectedPath)
+			if err != nil {
+				t.Fatalf("Failed to read %s, run the test with -update to create it: %v", expectedPath, err)
+			}
+			gotLines := strings.Split(got.String(), "\n")
+			expectedLines := strings.Split(string(expected), "\n")
+			for i := 0; i < max(len(gotLines), len(expectedLines)); i++ {
+				var g, e string
+				if i < len(gotLines) {
+					g = gotLines[i]
+				}
+				if i < len(expectedLines) {
+					e = expectedLines[i]
+				}
+				if g != e {
+					t.Fatalf("Line %d of %s differs:\n  Got:      %q\n  Expected: %q", i+1, expectedPath, g, e)
+				}
+			}
+		})
+	}
+}
+
 // TestParse checks the output of parsing example.fountain against a known-good structure.
 func TestParse(t *testing.T) {
 	scenes := []string{"INT", "EXT", "EST", "INT./EXT", "INT/EXT", "EXT/INT", "EXT./INT", "I/E"}
@@ -77,7 +152,7 @@ func TestParse(t *testing.T) {
 		}
 	}()
 
-	screenplay := Parse(scenes, file)
+	screenplay := mustParse(t, scenes, file).WithoutPositions()
 
 	// Note: The parser produces an extra `empty` line at the very end
 	// because of its "read-ahead" logic to terminate dialogue blocks.
@@ -101,10 +176,8 @@ func TestParse(t *testing.T) {
 		lex.Line{Type: lex.TypeScene, Contents: "EXT. GARDEN"},
 		lex.Line{Type: lex.TypeEmpty, Contents: ""},
 		lex.Line{Type: lex.TypeSpeaker, Contents: "TOM"},
-		lex.Line{Type: lex.TypeDialog, Contents: "What am I doing here now?"},
-		lex.Line{Type: lex.TypeDialog, Contents: "To be honest, I have absolutely no idea!"},
-		lex.Line{Type: lex.TypeEmpty, Contents: ""},
-		lex.Line{Type: lex.TypeAction, Contents: "And that means really no idea!"},
+		lex.Line{Type: lex.TypeDialog, Contents: "What am I doing here now?\nTo be honest, I have absolutely no idea!" +
+			"\n\nAnd that means really no idea!"},
 		lex.Line{Type: lex.TypeEmpty, Contents: ""},
 	}
 
@@ -139,7 +212,7 @@ I am speaking.
 TOM ^
 At the same time.`
 	reader := strings.NewReader(fountainContent)
-	screenplay := Parse(scenes, reader)
+	screenplay := mustParse(t, scenes, reader).WithoutPositions()
 
 	expected := lex.Screenplay{
 		lex.Line{Type: lex.TypeTitlePage, Contents: ""},
@@ -174,3 +247,664 @@ At the same time.`
 		}
 	}
 }
+
+// TestParsePositions checks that every element records the row it was read from,
+// including title page values and synthesized markers.
+func TestParsePositions(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `Title: Test Scene
+Author: Someone
+
+INT. ROOM - DAY
+
+    Indented action.
+
+MARY
+Hello.`
+	screenplay := mustParse(t, scenes, strings.NewReader(fountainContent))
+
+	expected := []struct {
+		Type     string
+		Contents string
+		Pos      lex.Position
+	}{
+		{lex.TypeTitlePage, "", lex.Position{Line: 1, Col: 1, EndLine: 1, EndCol: 18}},
+		{"Title", "Test Scene", lex.Position{Line: 1, Col: 1, EndLine: 1, EndCol: 18}},
+		{"Author", "Someone", lex.Position{Line: 2, Col: 1, EndLine: 2, EndCol: 16}},
+		{lex.TypeNewPage, "", lex.Position{Line: 3, Col: 1, EndLine: 3, EndCol: 1}},
+		{lex.TypeScene, "INT. ROOM - DAY", lex.Position{Line: 4, Col: 1, EndLine: 4, EndCol: 16}},
+		{lex.TypeEmpty, "", lex.Position{Line: 5, Col: 1, EndLine: 5, EndCol: 1}},
+		{lex.TypeAction, "    Indented action.", lex.Position{Line: 6, Col: 5, EndLine: 6, EndCol: 21}},
+		{lex.TypeEmpty, "", lex.Position{Line: 7, Col: 1, EndLine: 7, EndCol: 1}},
+		{lex.TypeSpeaker, "MARY", lex.Position{Line: 8, Col: 1, EndLine: 8, EndCol: 5}},
+		{lex.TypeDialog, "Hello.", lex.Position{Line: 9, Col: 1, EndLine: 9, EndCol: 7}},
+	}
+
+	if len(screenplay) < len(expected) {
+		t.Fatalf("Got %d lines, expected at least %d: %+v", len(screenplay), len(expected), screenplay)
+	}
+	for i, want := range expected {
+		got := screenplay[i]
+		if got.Type != want.Type || got.Contents != want.Contents || got.Pos != want.Pos {
+			t.Errorf("Line %d mismatch:\n  Got:      %s %q at %+v\n  Expected: %s %q at %+v",
+				i, got.Type, got.Contents, got.Pos, want.Type, want.Contents, want.Pos)
+		}
+	}
+}
+
+// TestParseNotesAndBoneyard checks that notes and boneyard blocks, including ones
+// spanning several rows, become their own elements without leaking into the script.
+func TestParseNotesAndBoneyard(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `INT. HOUSE - DAY
+
+Mary enters. [[Check the lighting]]
+
+/* This scene was cut.
+
+MARY
+Bye.
+*/
+
+MARY
+[[Whispering
+all along]]
+Hello.`
+	screenplay := mustParse(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	expected := lex.Screenplay{
+		lex.Line{Type: lex.TypeScene, Contents: "INT. HOUSE - DAY"},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+		lex.Line{Type: lex.TypeAction, Contents: "Mary enters."},
+		lex.Line{Type: lex.TypeNote, Contents: "Check the lighting", Inline: true, Offset: 12},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+		lex.Line{Type: lex.TypeBoneyard, Contents: " This scene was cut.\n\nMARY\nBye.\n"},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+		lex.Line{Type: lex.TypeSpeaker, Contents: "MARY"},
+		lex.Line{Type: lex.TypeNote, Contents: "Whispering\nall along"},
+		lex.Line{Type: lex.TypeDialog, Contents: "Hello."},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+	}
+
+	if !reflect.DeepEqual(screenplay, expected) {
+		t.Errorf("Parsed notes and boneyard do not match expected structure.")
+		t.Logf("Got:\n%#v\n", screenplay)
+		t.Logf("Expected:\n%#v\n", expected)
+	}
+
+	// Writing the screenplay back must keep the annotations intact.
+	var buffer bytes.Buffer
+	writer := &FountainWriter{SceneConfig: scenes}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	roundTrip := mustParse(t, scenes, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(roundTrip, expected) {
+		t.Errorf("Round-tripped notes and boneyard do not match.")
+		t.Logf("Got:\n%#v\n", roundTrip)
+	}
+}
+
+// TestSceneNumbers checks that #12A# scene numbers are parsed into the scene metadata
+// and written back by the FountainWriter.
+func TestSceneNumbers(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `INT. HOUSE - DAY #12A#
+
+.FLASHBACK #13#
+`
+	screenplay := mustParse(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	expected := lex.Screenplay{
+		lex.Line{Type: lex.TypeScene, Contents: "INT. HOUSE - DAY", SceneNumber: "12A"},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+		lex.Line{Type: lex.TypeScene, Contents: "FLASHBACK", SceneNumber: "13"},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+	}
+	if !reflect.DeepEqual(screenplay, expected) {
+		t.Errorf("Parsed scene numbers do not match expected structure.")
+		t.Logf("Got:\n%#v\n", screenplay)
+		t.Logf("Expected:\n%#v\n", expected)
+	}
+
+	var buffer bytes.Buffer
+	writer := &FountainWriter{SceneConfig: scenes}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	if got := buffer.String(); got != fountainContent {
+		t.Errorf("Written scene numbers do not match.\n  Got:      %q\n  Expected: %q", got, fountainContent)
+	}
+}
+
+// TestParagraphs checks that rows without a blank row between them form a single element,
+// that two spaces on a blank row keep a paragraph together and that action keeps its indentation.
+func TestParagraphs(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := "Mary waits.\n    The clock ticks.\n  \nNOTHING.\n\n" +
+		"MARY\nHello?\n  \nAnyone?\n(beat)\nNo.\n\n~Row, row, row\n~your boat\n"
+	screenplay := mustParse(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	expected := lex.Screenplay{
+		{Type: lex.TypeAction, Contents: "Mary waits.\n    The clock ticks.\n\nNOTHING."},
+		{Type: lex.TypeEmpty},
+		{Type: lex.TypeSpeaker, Contents: "MARY"},
+		{Type: lex.TypeDialog, Contents: "Hello?\n\nAnyone?"},
+		{Type: lex.TypeParen, Contents: "(beat)"},
+		{Type: lex.TypeDialog, Contents: "No."},
+		{Type: lex.TypeEmpty},
+		{Type: lex.TypeLyrics, Contents: "Row, row, row\nyour boat"},
+		{Type: lex.TypeEmpty},
+	}
+	if !reflect.DeepEqual(screenplay, expected) {
+		t.Errorf("Parsed paragraphs do not match.\n  Got:      %#v\n  Expected: %#v", screenplay, expected)
+	}
+
+	var buffer bytes.Buffer
+	if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	got := mustParse(t, scenes, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Round-tripped paragraphs do not match.\n  Got:      %#v\n  Expected: %#v", got, expected)
+	}
+}
+
+// TestTitlePage checks multi-line values, other keys and the indentation rules of the title page.
+func TestTitlePage(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := "Title:\n    _**BRICK & STEEL**_\n\t_**FULL RETIRED**_\n" +
+		"Credit: Written by\nAuthor: Stu Maschwitz\n" +
+		"Contact:\n   Next Level Productions\n   Phone: 555-1234\n" +
+		"Revision: Blue\nDraft date: 1/20/2012\n\nFADE IN:\n"
+	screenplay := mustParse(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	expected := lex.Screenplay{
+		{Type: lex.TypeTitlePage},
+		{Type: lex.KeyTitle, Contents: "_**BRICK & STEEL**_\n_**FULL RETIRED**_"},
+		{Type: lex.KeyCredit, Contents: "Written by"},
+		{Type: lex.KeyAuthor, Contents: "Stu Maschwitz"},
+		{Type: lex.TypeMetaSection},
+		{Type: lex.KeyContact, Contents: "Next Level Productions\nPhone: 555-1234"},
+		{Type: "Revision", Contents: "Blue"},
+		{Type: lex.KeyDraftDate, Contents: "1/20/2012"},
+		{Type: lex.TypeNewPage},
+		{Type: lex.TypeAction, Contents: "FADE IN:"},
+		{Type: lex.TypeEmpty},
+	}
+	if !reflect.DeepEqual(screenplay, expected) {
+		t.Errorf("Parsed title page does not match.\n  Got:      %#v\n  Expected: %#v", screenplay, expected)
+	}
+
+	var buffer bytes.Buffer
+	if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	got := mustParse(t, scenes, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Round-tripped title page does not match.\n  Got:      %#v\n  Expected: %#v", got, expected)
+	}
+}
+
+// TestExtensions checks that character extensions are split from speaker names and written back.
+func TestExtensions(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `JOHN (V.O.)
+Hello.
+
+@McCLANE (cont'd) ^
+Hi.
+`
+	screenplay := mustParse(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	var speakers []lex.Line
+	for _, line := range screenplay {
+		if line.Type == lex.TypeSpeaker {
+			speakers = append(speakers, line)
+		}
+	}
+	expected := []lex.Line{
+		{Type: lex.TypeSpeaker, Contents: "JOHN", Extensions: []string{"V.O."}},
+		{Type: lex.TypeSpeaker, Contents: "McCLANE", Extensions: []string{"cont'd"}},
+	}
+	if !reflect.DeepEqual(speakers, expected) {
+		t.Errorf("Parsed speakers do not match.\n  Got:      %#v\n  Expected: %#v", speakers, expected)
+	}
+
+	var buffer bytes.Buffer
+	writer := &FountainWriter{SceneConfig: scenes}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	if got := buffer.String(); got != fountainContent {
+		t.Errorf("Written extensions do not match.\n  Got:      %q\n  Expected: %q", got, fountainContent)
+	}
+}
+
+func TestLockedPageBreak(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	fountainContent := `Mary waits.
+
+=== #12A#
+
+===
+`
+	screenplay := mustParse(t, scenes, strings.NewReader(fountainContent)).WithoutPositions()
+
+	expected := lex.Screenplay{
+		lex.Line{Type: lex.TypeAction, Contents: "Mary waits."},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+		lex.Line{Type: lex.TypeNewPage, Contents: "12A"},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+		lex.Line{Type: lex.TypeNewPage, Contents: ""},
+		lex.Line{Type: lex.TypeEmpty, Contents: ""},
+	}
+	if !reflect.DeepEqual(screenplay, expected) {
+		t.Errorf("Parsed page breaks do not match expected structure.")
+		t.Logf("Got:\n%#v\n", screenplay)
+		t.Logf("Expected:\n%#v\n", expected)
+	}
+
+	var buffer bytes.Buffer
+	writer := &FountainWriter{SceneConfig: scenes}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	if got := buffer.String(); got != fountainContent {
+		t.Errorf("Written page breaks do not match.\n  Got:      %q\n  Expected: %q", got, fountainContent)
+	}
+}
+
+// mustParse parses a Fountain file and fails the test on errors
+func mustParse(t *testing.T, scenes []string, r io.Reader) lex.Screenplay {
+	t.Helper()
+	screenplay, err := Parse(scenes, r)
+	if err != nil {
+		t.Fatalf("Parse returned an unexpected error: %v", err)
+	}
+	return screenplay
+}
+
+func mustParsePreserving(t *testing.T, scenes []string, r io.Reader) lex.Screenplay {
+	t.Helper()
+	screenplay, err := ParsePreserving(scenes, r)
+	if err != nil {
+		t.Fatalf("ParsePreserving returned an unexpected error: %v", err)
+	}
+	return screenplay
+}
+
+// TestParseInvalidText checks that input which isn't UTF-8 text is reported with its position.
+func TestParseInvalidText(t *testing.T) {
+	input := "INT. HOUSE - DAY\n\nCaf\xe9 au lait.\n"
+	_, err := Parse([]string{"INT"}, strings.NewReader(input))
+	var parseErr *lex.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a lex.ParseError, got %v", err)
+	}
+	if expected := "3:4: invalid UTF-8 text"; err.Error() != expected {
+		t.Errorf("Got error %q, expected %q", err.Error(), expected)
+	}
+}
+
+// TestForcedElements checks that the writer forces the elements that would otherwise be read as something else.
+func TestForcedElements(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	screenplay := lex.Screenplay{
+		{Type: lex.TypeScene, Contents: "flashback"},
+		{Type: lex.TypeEmpty},
+		{Type: lex.TypeAction, Contents: "BANG\n# Not a section"},
+		{Type: lex.TypeEmpty},
+		{Type: lex.TypeSpeaker, Contents: "McCLANE"},
+		{Type: lex.TypeDialog, Contents: "!Yippee"},
+		{Type: lex.TypeEmpty},
+		{Type: lex.TypeTrans, Contents: "FADE OUT."},
+		{Type: lex.TypeEmpty},
+		{Type: lex.TypeCenter, Contents: "The *End*"},
+		{Type: lex.TypeEmpty},
+	}
+	expected := ".flashback\n\n!BANG\n!# Not a section\n\n@McCLANE\n !Yippee\n\n> FADE OUT.\n\n> The *End* <\n"
+
+	var buffer bytes.Buffer
+	if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	if got := buffer.String(); got != expected {
+		t.Errorf("Written elements do not match.\n  Got:      %q\n  Expected: %q", got, expected)
+	}
+	if got := mustParse(t, scenes, &buffer).WithoutPositions(); !reflect.DeepEqual(got, screenplay) {
+		t.Errorf("Round-tripped elements do not match.\n  Got:      %#v\n  Expected: %#v", got, screenplay)
+	}
+}
+
+// fountainSource is random Fountain text for property-based tests, built from rows that
+// exercise every element type, forcing character and context rule of the parser.
+type fountainSource string
+
+// sourceRows are the building blocks of fountainSource, %s is replaced by random words
+var sourceRows = []string{
+	"", "", "", "  ",
+	"INT. HOUSE - DAY", "EXT. GARDEN #12A#", "int. lower case", ".flashback", ".%s", "...%s",
+	"CUT TO:", "> Fade out.", "%s to:", "> The *End* <", ">%s<",
+	"MARY", "TOM (V.O.)", "@McCLANE", "BRICK ^", "STEEL (O.S.) ^", "MARY (CONT'D)", "%S",
+	"(beat)", "(%s)", `\(%s)`, `\> %s`, "%s", "%s", "%s", "%S!", "%s: %s",
+	"!BANG", "!%s", "!  %s", "~%s", "@%s", "   %s", "\t%s",
+	"= %s", "# %s", "## %s", "===", "=== #3#", "%s\r", "MARY\r",
+	"[[%s]]", "%s [[%s]] %s", "/* %s */",
+}
+
+// sourceWords are the random words, including inline markup
+var sourceWords = []string{
+	"mary", "waits", "INT.", "the", "*door*", "**BANG**", "_under_", `\*`, "TO:", "(V.O.)", "^", "END",
+}
+
+// Generate implements quick.Generator
+func (fountainSource) Generate(r *rand.Rand, size int) reflect.Value {
+	words := func() string {
+		var w []string
+		for range 1 + r.Intn(4) {
+			w = append(w, sourceWords[r.Intn(len(sourceWords))])
+		}
+		return strings.Join(w, " ")
+	}
+
+	var b strings.Builder
+	if r.Intn(3) == 0 {
+		b.WriteString("Title: " + words() + "\nAuthor: " + words() + "\nContact:\n    " + words() + "\n\n")
+	}
+	// Elements are mostly separated by blank rows, like in a real screenplay
+	for range 1 + r.Intn(min(size, 20)) {
+		row := sourceRows[r.Intn(len(sourceRows))]
+		for strings.Contains(row, "%s") {
+			row = strings.Replace(row, "%s", words(), 1)
+		}
+		row = strings.ReplaceAll(row, "%S", strings.ToUpper(words()))
+		b.WriteString(row + "\n")
+		if r.Intn(3) == 0 {
+			b.WriteString("\n")
+		}
+	}
+	return reflect.ValueOf(fountainSource(b.String()))
+}
+
+// TestWriteRoundTripProperty checks that writing any parsed screenplay to Fountain and parsing
+// it again gives the same screenplay, so the writer adds whatever forcing characters are needed.
+func TestWriteRoundTripProperty(t *testing.T) {
+	scenes := []string{"INT", "EXT", "EST", "INT./EXT", "INT/EXT", "EXT/INT", "EXT./INT", "I/E"}
+	roundTrip := func(source fountainSource) bool {
+		original, _ := Parse(scenes, strings.NewReader(string(source)))
+		original = original.WithoutPositions()
+		var buffer bytes.Buffer
+		if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, original); err != nil {
+			t.Logf("Write failed: %v", err)
+			return false
+		}
+		written := buffer.String()
+		got, _ := Parse(scenes, &buffer)
+		if got = got.WithoutPositions(); !reflect.DeepEqual(got, original) {
+			i := 0
+			for i < min(len(got), len(original)) && reflect.DeepEqual(got[i], original[i]) {
+				i++
+			}
+			t.Logf("Source:\n%s\nWritten:\n%s\nFirst difference at line %d:\n  Original:  %v\n  RoundTrip: %v",
+				source, written, i, original[i:min(i+3, len(original))], got[i:min(i+3, len(got))])
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+// screenplayValue is a random screenplay for property-based tests, built from elements the way
+// the parser gives them, so the writer also gets text that no Fountain source was read from.
+type screenplayValue lex.Screenplay
+
+// screenplayWords are the random words of screenplayValue, including ones that make a row look like another element
+var screenplayWords = []string{
+	"mary", "WAITS", "the", "INT.", "EXT", "(beat)", "(", ")", "TO:", "to:", ">", "<",
+	"!", "@", "~", "=", "#", ".", "^", ":", "===", `\`, "*door*",
+}
+
+// Generate implements quick.Generator
+func (screenplayValue) Generate(r *rand.Rand, size int) reflect.Value {
+	words := func() string {
+		var w []string
+		for range 1 + r.Intn(4) {
+			w = append(w, screenplayWords[r.Intn(len(screenplayWords))])
+		}
+		return strings.Join(w, " ")
+	}
+	rows := func() string {
+		var w []string
+		for range 1 + r.Intn(3) {
+			w = append(w, words())
+		}
+		return strings.Join(w, "\n")
+	}
+
+	var screenplay lex.Screenplay
+	add := func(element lex.ElementType, contents string) {
+		screenplay = append(screenplay, lex.Line{Type: element, Contents: contents})
+	}
+	if r.Intn(3) == 0 {
+		add(lex.TypeTitlePage, "")
+		add(lex.KeyTitle, words())
+		add(lex.KeyAuthor, words())
+		add(lex.TypeNewPage, "")
+	}
+	for range 1 + r.Intn(min(size, 20)) {
+		switch r.Intn(10) {
+		case 0:
+			add(lex.TypeScene, "INT. "+strings.ToUpper(words()))
+			if r.Intn(2) == 0 {
+				screenplay[len(screenplay)-1].SceneNumber = "12A"
+			}
+		case 1:
+			add(lex.TypeScene, words())
+		case 2, 3:
+			add(lex.TypeAction, rows())
+		case 4, 5:
+			add(lex.TypeSpeaker, []string{"MARY", "TOM", "McCLANE"}[r.Intn(3)])
+			if r.Intn(3) == 0 {
+				screenplay[len(screenplay)-1].Extensions = []string{"V.O."}
+			}
+			dialog := false
+			for range 1 + r.Intn(3) {
+				if dialog = !dialog && r.Intn(3) != 0; dialog {
+					add(lex.TypeDialog, rows())
+				} else {
+					add(lex.TypeParen, "("+words()+")")
+				}
+			}
+		case 6:
+			add(lex.TypeTrans, []string{strings.ToUpper(words()), words()}[r.Intn(2)]+" TO:")
+		case 7:
+			add(lex.TypeCenter, words())
+		case 8:
+			add(lex.TypeLyrics, rows())
+		default:
+			add([]string{"synopse", lex.TypeNote, lex.TypeNewPage}[r.Intn(3)], words())
+			if screenplay[len(screenplay)-1].Type == lex.TypeNewPage {
+				screenplay[len(screenplay)-1].Contents = ""
+			}
+		}
+		add(lex.TypeEmpty, "")
+	}
+	return reflect.ValueOf(screenplayValue(screenplay))
+}
+
+// TestWriteScreenplayProperty checks that parsing the Fountain written for any screenplay gives the same
+// screenplay, also for text that was never read from Fountain, like dialogue written like a parenthetical.
+func TestWriteScreenplayProperty(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	roundTrip := func(value screenplayValue) bool {
+		original := lex.Screenplay(value)
+		var buffer bytes.Buffer
+		if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, original); err != nil {
+			t.Logf("Write failed: %v", err)
+			return false
+		}
+		written := buffer.String()
+		got, _ := Parse(scenes, &buffer)
+		if got = got.WithoutPositions(); !reflect.DeepEqual(got, original) {
+			i := 0
+			for i < min(len(got), len(original)) && reflect.DeepEqual(got[i], original[i]) {
+				i++
+			}
+			t.Logf("Written:\n%s\nFirst difference at line %d:\n  Original:  %v\n  RoundTrip: %v",
+				written, i, original[i:min(i+3, len(original))], got[i:min(i+3, len(got))])
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestPreserveRoundTripProperty checks that writing a screenplay parsed in preserve mode gives back the exact source.
+func TestPreserveRoundTripProperty(t *testing.T) {
+	scenes := []string{"INT", "EXT", "EST", "INT./EXT", "INT/EXT", "EXT/INT", "EXT./INT", "I/E"}
+	roundTrip := func(source fountainSource) bool {
+		screenplay, _ := ParsePreserving(scenes, strings.NewReader(string(source)))
+		var buffer bytes.Buffer
+		if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, screenplay); err != nil {
+			t.Logf("Write failed: %v", err)
+			return false
+		}
+		if got := buffer.String(); got != string(source) {
+			t.Logf("Source:\n%q\nWritten:\n%q", source, got)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestPreserve checks that preserve mode keeps the test files as they are, and that only changed elements
+// are written anew.
+func TestPreserve(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	files, err := filepath.Glob("../testdata/input/*.fountain")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No test files found: %v", err)
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		screenplay := mustParsePreserving(t, scenes, bytes.NewReader(source))
+		var buffer bytes.Buffer
+		if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, screenplay); err != nil {
+			t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+		}
+		if got := buffer.String(); got != string(source) {
+			t.Errorf("%s isn't written back as it was:\n%s", file, got)
+		}
+	}
+
+	head := "title: Big Fish\n\n\n\nint. house - day\n\n    MARY\n  Hello.   \r\n\n/* Cut:\nINT. GARDEN */\n"
+	source := head + "She leaves.\n"
+	screenplay := mustParsePreserving(t, scenes, strings.NewReader(source))
+	for i, line := range screenplay {
+		if line.Type == lex.TypeAction {
+			screenplay[i].Contents = "She stays."
+		}
+	}
+	expected := head + "She stays.\n"
+	var buffer bytes.Buffer
+	if err := (&FountainWriter{SceneConfig: scenes}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	if got := buffer.String(); got != expected {
+		t.Errorf("Changed screenplay doesn't match.\n  Got:      %q\n  Expected: %q", got, expected)
+	}
+
+	buffer.Reset()
+	if err := (&FountainWriter{SceneConfig: scenes, Reformat: true}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+	}
+	expected = "Title: Big Fish\n\n\n\nINT. HOUSE - DAY\n\nMARY\nHello.\n\n/* Cut:\nINT. GARDEN */\nShe stays.\n"
+	if got := buffer.String(); got != expected {
+		t.Errorf("Reformatted screenplay doesn't match.\n  Got:      %q\n  Expected: %q", got, expected)
+	}
+}
+
+// TestFormatProperty checks that formatting is stable: formatting formatted Fountain changes nothing.
+func TestFormatProperty(t *testing.T) {
+	scenes := []string{"INT", "EXT", "EST", "INT./EXT", "INT/EXT", "EXT/INT", "EXT./INT", "I/E"}
+	format := func(source string, force bool) string {
+		screenplay, _ := Parse(scenes, strings.NewReader(source))
+		var buffer bytes.Buffer
+		writer := &FountainWriter{SceneConfig: scenes, AlignTitle: true, ForceAll: force}
+		if err := writer.Write(&buffer, Format(screenplay)); err != nil {
+			t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+		}
+		return buffer.String()
+	}
+	stable := func(source fountainSource, force bool) bool {
+		once := format(string(source), force)
+		if twice := format(once, force); twice != once {
+			t.Logf("Source:\n%q\nFormatted:\n%q\nFormatted again:\n%q", source, once, twice)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(stable, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestFormat checks the normalizations of Format and the writer options used for formatting.
+func TestFormat(t *testing.T) {
+	scenes := []string{"INT", "EXT"}
+	source := "\ntitle: Big Fish\ndraft date: 1/1/2025\nContact:\n    Mary\n    Phone: 555\n\n\n\n" +
+		".int. house - day\n\n\n\nMary waits.\n\n@MARY\nHello.\n\n> fade out.\n\n\n"
+	screenplay := mustParse(t, scenes, strings.NewReader(source))
+
+	tests := []struct {
+		force    bool
+		expected string
+	}{
+		{false, "Title:      Big Fish\nDraft date: 1/1/2025\nContact:\n    Mary\n    Phone: 555\n\n" +
+			"INT. HOUSE - DAY\n\nMary waits.\n\nMARY\nHello.\n\n> FADE OUT.\n"},
+		{true, "Title:      Big Fish\nDraft date: 1/1/2025\nContact:\n    Mary\n    Phone: 555\n\n" +
+			".INT. HOUSE - DAY\n\n!Mary waits.\n\n@MARY\nHello.\n\n> FADE OUT.\n"},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		writer := &FountainWriter{SceneConfig: scenes, AlignTitle: true, ForceAll: test.force}
+		if err := writer.Write(&buffer, Format(screenplay)); err != nil {
+			t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+		}
+		if got := buffer.String(); got != test.expected {
+			t.Errorf("Formatted with ForceAll %v doesn't match.\n  Got:      %q\n  Expected: %q", test.force, got, test.expected)
+		}
+	}
+
+	// Notes and boneyard stay where they are, inline ones inside the text
+	annotated := []struct {
+		source   string
+		expected string
+	}{
+		{"Mary waits [[a note]] by the door.\n", "Mary waits [[a note]] by the door.\n"},
+		{"MARY [[loud]]\nHello [[beat]]\n", "MARY [[loud]]\nHello [[beat]]\n"},
+		{"INT. HOUSE\n\n/* old\nscene */\n\n\ncut to:\n", "INT. HOUSE\n\n/* old\nscene */\n\ncut to:\n"},
+		{"INT. HOUSE\n\n[[a note]]\n\n\n\nMary waits.\n", "INT. HOUSE\n\n[[a note]]\n\nMary waits.\n"},
+	}
+	for _, test := range annotated {
+		var buffer bytes.Buffer
+		writer := &FountainWriter{SceneConfig: scenes}
+		if err := writer.Write(&buffer, Format(mustParse(t, scenes, strings.NewReader(test.source)))); err != nil {
+			t.Fatalf("FountainWriter.Write returned an unexpected error: %v", err)
+		}
+		if got := buffer.String(); got != test.expected {
+			t.Errorf("Formatted %q doesn't match.\n  Got:      %q\n  Expected: %q", test.source, got, test.expected)
+		}
+	}
+}
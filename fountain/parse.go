@@ -2,8 +2,11 @@ package fountain
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/LaPingvino/lexington/internal"
 	"github.com/LaPingvino/lexington/lex"
@@ -35,21 +38,24 @@ func CheckScene(row string) (bool, string, string) {
 }
 
 // CheckCrow determines if a row is a transition or a centered text.
+// Centered text like > THE END < and forced transitions keep their case, writers print transitions in capitals.
+// Transitions are either forced with > or written in capitals ending in TO:.
 func CheckCrow(row string) (bool, string, string) {
-	var crow bool
-	var el string
-	row = strings.ToUpper(row)
-	if strings.HasPrefix(row, ">") || strings.HasSuffix(row, " TO:") {
-		crow = true
-		el = "trans"
-	}
-	if strings.HasPrefix(row, ">") && strings.HasSuffix(row, "<") {
-		el = "center"
-	}
-	return crow, el, strings.Trim(row, ">< ")
+	row = strings.TrimSpace(row)
+	switch {
+	case len(row) > 1 && strings.HasPrefix(row, ">") && strings.HasSuffix(row, "<"):
+		return true, lex.TypeCenter, strings.TrimSpace(row[1 : len(row)-1])
+	case strings.HasPrefix(row, ">"):
+		return true, lex.TypeTrans, strings.TrimSpace(row[1:])
+	case strings.HasSuffix(row, " TO:") && row == strings.ToUpper(row):
+		return true, lex.TypeTrans, row
+	}
+	return false, lex.TypeTrans, row
 }
 
 // CheckEqual determines if a row is a synopsis or a page break.
+// The contents of a page break are its locked page number, if any.
+// Inside dialogue a row starting with = is dialogue, the parser takes care of that.
 func CheckEqual(row string) (bool, string, string) {
 	var equal bool
 	var el string
@@ -57,10 +63,12 @@ func CheckEqual(row string) (bool, string, string) {
 		equal = true
 		el = "synopse"
 	}
-	if len(row) >= 3 && strings.Trim(row, "=") == "" {
-		el = "newpage"
+	// A page break may carry a locked page number like === #12A#
+	breakRow, number := lex.SplitSceneNumber(row)
+	if len(breakRow) >= 3 && strings.Trim(breakRow, "=") == "" {
+		return equal, "newpage", number
 	}
-	return equal, el, strings.TrimLeft(row, "= ")
+	return equal, el, strings.TrimPrefix(row, "=")
 }
 
 // CheckSection determines if a row is a section heading.
@@ -101,67 +109,207 @@ type ParseState struct {
 	titlepage             bool
 	inDialogueContext     bool
 	inDualDialogue        bool
-	titletag              string
+	titleKey              int  // Index of the title page key that indented rows are added to
+	titleMeta             bool // The metasection of the title page has been added
+	blankBefore           bool // The previous row was blank, or the screenplay body starts here
+	blankAfter            bool // The next row is blank or the end of the file
 	consecutiveEmptyLines int
 	hasTitlePageContent   bool
+	file                  string       // Name of the source file, if known
+	pos                   lex.Position // Position of the row currently being parsed
 	out                   lex.Screenplay
 }
 
 // Parse converts a Fountain file into the internal lex.Screenplay format.
-func Parse(scenes []string, file io.Reader) (out lex.Screenplay) {
+// Notes ([[ ]]) and boneyard (/* */) blocks become separate note and boneyard
+// elements following the element they were found in. Character extensions like (V.O.)
+// are split from the speaker names. Action, dialogue and lyrics spanning several rows
+// become a single element with newlines between the rows, action keeps its indentation.
+// Any text is valid Fountain, so errors are only returned for input that can't be read
+// or isn't UTF-8 text, together with everything that could be parsed.
+func Parse(scenes []string, file io.Reader) (lex.Screenplay, error) {
+	return parse(scenes, file, false)
+}
+
+// ParsePreserving parses like Parse and keeps the source text of every element in its Source,
+// including blank rows, indentation, forcing characters and the case of title page keys.
+// FountainWriter writes the elements that weren't changed back exactly as they were read.
+func ParsePreserving(scenes []string, file io.Reader) (lex.Screenplay, error) {
+	return parse(scenes, file, true)
+}
+
+func parse(scenes []string, file io.Reader, preserve bool) (lex.Screenplay, error) {
 	Scene = scenes
 
-	toParse := readAllLines(file)
+	name := lex.SourceName(file)
+	toParse, err := readAllLines(file)
+	errs := invalidRows(name, toParse)
+	if err != nil {
+		errs = append(errs, &lex.ParseError{Pos: lex.Position{File: name, Line: len(toParse)}, Err: err})
+	}
 
 	state := &ParseState{
-		scenes:    scenes,
-		titlepage: true,
-		out:       make(lex.Screenplay, 0),
+		scenes:      scenes,
+		titlepage:   true,
+		blankBefore: true,
+		file:        name,
+		out:         make(lex.Screenplay, 0),
+	}
+
+	rows := extractAnnotations(state.file, toParse)
+	for i, row := range rows {
+		// Rows holding nothing but notes or boneyard don't interrupt the surrounding element
+		if !row.onlyHidden {
+			state.blankAfter = blankAfter(rows[i+1:])
+			state.parseRow(row.text, i, len(toParse))
+			markInline(state.out, row, i+1)
+		}
+		state.out = append(state.out, row.annotations...)
+	}
+	splitExtensions(state.out)
+	if preserve {
+		state.out = keepSource(toParse, state.out)
+	}
+
+	return state.out, errors.Join(errs...)
+}
+
+// keepSource gives every element the source rows up to its last row that no element before
+// it has taken yet. Rows left at the end of the file go to the last element that has rows,
+// or to an empty line if there is none, like in a file with only empty title page keys.
+func keepSource(rows []string, screenplay lex.Screenplay) lex.Screenplay {
+	done, last := 0, -1
+	for i, line := range screenplay {
+		end := max(line.Pos.EndLine, line.Pos.Line)
+		if !ownsRows(line, rows) || end <= done {
+			screenplay[i].Source = lex.NewSource(line, "")
+			continue
+		}
+		screenplay[i].Source = lex.NewSource(line, strings.Join(rows[done:end], ""))
+		done, last = end, i
+	}
+	rest := strings.Join(rows[done:], "")
+	switch {
+	case rest == "":
+	case last >= 0:
+		screenplay[last].Source.Text += rest
+	default:
+		empty := lex.Line{Type: lex.TypeEmpty}
+		empty.Source = lex.NewSource(empty, rest)
+		screenplay = append(screenplay, empty)
 	}
+	return screenplay
+}
 
-	for i, row := range toParse {
-		originalRow := row
-		row = strings.TrimRight(originalRow, "\n\r")
-		trimmedSpaceRow := strings.TrimSpace(row)
+// ownsRows returns false for the lines that only mark structure, like the start of the title
+// page or dual dialogue, and for the end of a title page that isn't a blank row or page break.
+func ownsRows(line lex.Line, rows []string) bool {
+	switch {
+	case line.IsDualDialogueMarker(), line.Type == lex.TypeTitlePage, line.Type == lex.TypeMetaSection:
+		return false
+	case line.Type == lex.TypeNewPage && line.Pos.Line > 0 && line.Pos.Line <= len(rows):
+		row := strings.TrimSpace(rows[line.Pos.Line-1])
+		_, element, _ := CheckEqual(row)
+		return row == "" || element == lex.TypeNewPage
+	default:
+		return line.Pos.Line > 0
+	}
+}
 
-		var currentLine lex.Line
-		var isCurrentLineDualSpeakerCandidate bool
+// splitExtensions separates the character extensions from the names of all speakers.
+// This is done after parsing, as a speaker turns out to be action if no dialogue follows.
+func splitExtensions(screenplay lex.Screenplay) {
+	for i, line := range screenplay {
+		if line.Type == lex.TypeSpeaker {
+			screenplay[i].Contents, screenplay[i].Extensions = lex.SplitExtensions(line.Contents)
+		}
+	}
+}
 
-		// Handle title page parsing
-		if state.titlepage {
-			if handled := state.handleTitlePage(row, trimmedSpaceRow, &currentLine); handled {
-				continue
+// blankAfter returns true if the next row, leaving out rows holding only notes or boneyard,
+// is blank or if there are no more rows.
+func blankAfter(rows []sourceRow) bool {
+	for _, row := range rows {
+		if !row.onlyHidden {
+			return strings.TrimSpace(row.text) == ""
+		}
+	}
+	return true
+}
+
+// invalidRows returns an error for every row that isn't valid UTF-8, which usually means
+// the input is a binary file or uses another text encoding.
+func invalidRows(file string, rows []string) []error {
+	var errs []error
+	for i, row := range rows {
+		if !utf8.ValidString(row) {
+			col := 1
+			for len(row) > 0 {
+				r, size := utf8.DecodeRuneInString(row)
+				if r == utf8.RuneError && size <= 1 {
+					break
+				}
+				row = row[size:]
+				col += size
 			}
+			pos := lex.Position{File: file, Line: i + 1, Col: col}
+			errs = append(errs, lex.Errorf(pos, "invalid UTF-8 text"))
 		}
+	}
+	return errs
+}
 
-		// Parse screenplay body
-		currentLine, isCurrentLineDualSpeakerCandidate = state.parseScreenplayLine(originalRow, row, trimmedSpaceRow)
+// parseRow parses a single row of the Fountain source into the output.
+func (state *ParseState) parseRow(originalRow string, i, totalLines int) {
+	row := strings.TrimRight(originalRow, "\n\r")
+	trimmedSpaceRow := strings.TrimSpace(row)
+	state.pos = lex.RowPosition(state.file, i+1, row)
 
-		// Handle dual dialogue logic
-		state.handleDualDialogue(currentLine, isCurrentLineDualSpeakerCandidate, i, len(toParse))
+	// Handle title page parsing
+	if state.titlepage && state.handleTitlePage(row, trimmedSpaceRow) {
+		return
+	}
 
-		// Append line if appropriate
-		if state.shouldAppendLine(currentLine, trimmedSpaceRow, i, len(toParse)) {
-			state.out = append(state.out, currentLine)
-		}
+	// Parse screenplay body
+	currentLine, isCurrentLineDualSpeakerCandidate := state.parseScreenplayLine(originalRow, row, trimmedSpaceRow)
+	currentLine.Pos = state.pos
 
-		// Update dialogue context for next iteration
+	// Rows continuing the paragraph of the previous row are added to it
+	if state.continueParagraph(currentLine) {
 		state.updateDialogueContext(currentLine)
+		state.blankBefore = false
+		return
 	}
 
-	return state.out
+	// Handle dual dialogue logic
+	state.handleDualDialogue(currentLine, isCurrentLineDualSpeakerCandidate, i, totalLines)
+
+	// Append line if appropriate
+	if state.shouldAppendLine(currentLine, trimmedSpaceRow, i, totalLines) {
+		state.out = append(state.out, currentLine)
+	}
+
+	// Update dialogue context for next iteration
+	state.updateDialogueContext(currentLine)
+	state.blankBefore = currentLine.Type == lex.TypeEmpty || currentLine.Type == lex.TypeNewPage
 }
 
-func readAllLines(file io.Reader) []string {
+// readAllLines reads the rows of the file including their line endings, followed by an empty
+// sentinel row. It returns the rows read so far and the error if reading fails.
+func readAllLines(file io.Reader) ([]string, error) {
 	var toParse []string
+	var readErr error
 	f := bufio.NewReader(file)
 
 	for {
 		s, err := f.ReadString('\n')
 		if err != nil {
-			if err == io.EOF && len(s) > 0 {
+			if len(s) > 0 {
 				toParse = append(toParse, s)
 			}
+			if err != io.EOF {
+				readErr = err
+			}
 			break
 		}
 		toParse = append(toParse, s)
@@ -169,74 +317,99 @@ func readAllLines(file io.Reader) []string {
 
 	// Add sentinel empty line for final closing logic
 	toParse = append(toParse, "")
-	return toParse
+	return toParse, readErr
 }
 
-func (state *ParseState) handleTitlePage(row, trimmedSpaceRow string, currentLine *lex.Line) bool {
-	isKeyValLine := strings.Contains(row, ":") && !strings.HasPrefix(row, "   ")
-
-	// Check for consecutive empty lines
-	if trimmedSpaceRow == "" {
+// handleTitlePage parses a row of the title page and returns true if the row was part of it.
+// The title page consists of keys like "Title: Big Fish" at the very start of the file and ends
+// at the first blank line. Values can continue on the following rows when those are indented
+// with at least three spaces or a tab, and can also start on the row after the key.
+func (state *ParseState) handleTitlePage(row, trimmedSpaceRow string) bool {
+	indented := strings.HasPrefix(row, "   ") || strings.HasPrefix(row, "\t")
+	key, value, isKey := titlePageKey(row)
+
+	switch {
+	case trimmedSpaceRow == "" && !state.hasTitlePageContent:
+		// Blank rows before the title page are skipped
 		state.consecutiveEmptyLines++
-	} else {
-		state.consecutiveEmptyLines = 0
+		state.titlepage = state.consecutiveEmptyLines < 2
+		return true
+	case indented && state.hasTitlePageContent:
+		state.continueTitleValue(trimmedSpaceRow)
+		return true
+	case isKey && !indented:
+		state.addTitleKey(key, value)
+		return true
 	}
 
-	// Check if we should exit title page mode
-	if (!isKeyValLine && trimmedSpaceRow != "") || (state.consecutiveEmptyLines >= 2) {
-		state.titlepage = false
-		if state.hasTitlePageContent {
-			state.out = append(state.out, lex.Line{Type: lex.TypeNewPage})
-		}
-		if trimmedSpaceRow == "" {
-			return true // Skip this empty line
+	// A blank row ends the title page, any other row means the screenplay starts right away
+	state.titlepage = false
+	if state.hasTitlePageContent {
+		state.dropEmptyTitleKey()
+		if last := len(state.out) - 1; state.out[last].Type == lex.TypeTitlePage {
+			// Nothing is left of a title page with only empty keys
+			state.out = state.out[:last]
+		} else {
+			state.out = append(state.out, lex.Line{Type: lex.TypeNewPage, Pos: state.pos})
 		}
-		return false // Process as screenplay body
 	}
+	return trimmedSpaceRow == ""
+}
 
-	// Still in title page mode
-	if state.titletag == "" && trimmedSpaceRow != "" {
-		state.out = append(state.out, lex.Line{Type: lex.TypeTitlePage})
-		state.hasTitlePageContent = true
+// titlePageKey splits a row like "Draft date: 1/1/2025" into the key and its value.
+// It returns false if the row isn't a key.
+func titlePageKey(row string) (string, string, bool) {
+	key, value, found := strings.Cut(row, ":")
+	if !found || strings.TrimSpace(key) == "" || strings.TrimLeft(key, " \t") != key {
+		return "", "", false
 	}
+	switch strings.ToLower(key) {
+	case "title":
+		key = lex.KeyTitle
+	case "credit":
+		key = lex.KeyCredit
+	case "author", "authors":
+		key = lex.KeyAuthor
+	}
+	return key, strings.TrimSpace(value), true
+}
 
-	if isKeyValLine {
-		state.parseTitlePageKeyValue(row, currentLine)
-	} else {
-		currentLine.Type = state.titletag
-		currentLine.Contents = trimmedSpaceRow
+// addTitleKey starts a new key of the title page. The first key opens the title page and
+// a metasection separates the title, credit and author from the other keys.
+func (state *ParseState) addTitleKey(key, value string) {
+	if !state.hasTitlePageContent {
+		state.out = append(state.out, lex.Line{Type: lex.TypeTitlePage, Pos: state.pos})
 		state.hasTitlePageContent = true
 	}
-
-	if currentLine.Contents == "" {
-		return true // Skip empty content lines
+	state.dropEmptyTitleKey()
+	if !state.titleMeta && key != lex.KeyTitle && key != lex.KeyCredit && key != lex.KeyAuthor {
+		state.titleMeta = true
+		state.out = append(state.out, lex.Line{Type: lex.TypeMetaSection, Pos: state.pos})
 	}
-
-	state.out = append(state.out, *currentLine)
-	return true
+	state.titleKey = len(state.out)
+	state.out = append(state.out, lex.Line{Type: key, Contents: value, Pos: state.pos})
 }
 
-func (state *ParseState) parseTitlePageKeyValue(row string, currentLine *lex.Line) {
-	split := strings.SplitN(row, ":", 2)
-	currentMetaTag := split[0]
+// continueTitleValue adds an indented row to the value of the current title page key
+func (state *ParseState) continueTitleValue(text string) {
+	line := &state.out[state.titleKey]
+	if line.Contents != "" {
+		line.Contents += "\n"
+	}
+	line.Contents += text
+	line.Pos.EndLine, line.Pos.EndCol = state.pos.EndLine, state.pos.EndCol
+}
 
-	switch strings.ToLower(currentMetaTag) {
-	case "title":
-		state.titletag = "Title"
-	case "credit":
-		state.titletag = "Credit"
-	case "author", "authors":
-		state.titletag = "Author"
-	default:
-		if state.titletag == "Title" || state.titletag == "Credit" || state.titletag == "Author" {
-			state.out = append(state.out, lex.Line{Type: "metasection"})
+// dropEmptyTitleKey removes the current title page key if it didn't get a value,
+// together with the metasection right before it
+func (state *ParseState) dropEmptyTitleKey() {
+	if state.titleKey > 0 && state.titleKey == len(state.out)-1 && state.out[state.titleKey].Contents == "" {
+		state.out = state.out[:state.titleKey]
+		if last := len(state.out) - 1; state.out[last].Type == lex.TypeMetaSection {
+			state.out = state.out[:last]
+			state.titleMeta = false
 		}
-		state.titletag = currentMetaTag
 	}
-
-	currentLine.Type = state.titletag
-	currentLine.Contents = strings.TrimSpace(split[1])
-	state.hasTitlePageContent = true
 }
 
 func (state *ParseState) parseScreenplayLine(originalRow, row, trimmedSpaceRow string) (lex.Line, bool) {
@@ -244,6 +417,11 @@ func (state *ParseState) parseScreenplayLine(originalRow, row, trimmedSpaceRow s
 	var isCurrentLineDualSpeakerCandidate bool
 
 	if trimmedSpaceRow == "" {
+		// Two spaces on an otherwise blank row keep the paragraph together
+		if last := state.paragraph(); last != nil && strings.Count(row, " ") >= 2 {
+			currentLine.Type = last.Type
+			return currentLine, false
+		}
 		currentLine.Type = lex.TypeEmpty
 		currentLine.Contents = ""
 		return currentLine, false
@@ -253,9 +431,11 @@ func (state *ParseState) parseScreenplayLine(originalRow, row, trimmedSpaceRow s
 	if check, ftype, contents := CheckForce(originalRow); check {
 		currentLine.Type = ftype
 		currentLine.Contents = strings.TrimSpace(contents)
-		if ftype == lex.TypeSpeaker && strings.HasSuffix(currentLine.Contents, "^") {
-			isCurrentLineDualSpeakerCandidate = true
-			currentLine.Contents = strings.TrimRight(currentLine.Contents, " ^")
+		if ftype == lex.TypeAction {
+			currentLine.Contents = strings.TrimRightFunc(contents, unicode.IsSpace)
+		}
+		if ftype == lex.TypeSpeaker {
+			currentLine.Contents, isCurrentLineDualSpeakerCandidate = dualSpeaker(currentLine.Contents)
 		}
 		return currentLine, isCurrentLineDualSpeakerCandidate
 	}
@@ -269,78 +449,157 @@ func (state *ParseState) parseScreenplayLine(originalRow, row, trimmedSpaceRow s
 	return state.checkInferredTypes(row, trimmedSpaceRow)
 }
 
+// dualSpeaker removes the caret from a speaker like "BRICK ^" and returns true if it had one.
+// The caret marks the second speaker of a dual dialogue only after a name.
+func dualSpeaker(name string) (string, bool) {
+	trimmed := strings.TrimRight(name, " ^")
+	if trimmed == name || trimmed == "" {
+		return name, false
+	}
+	return trimmed, true
+}
+
 func (state *ParseState) checkStructuralTypes(row string) lex.Line {
 	checkfuncs := []func(string) (bool, string, string){
 		CheckScene,
-		CheckCrow,
+		// Synopses and sections ending in TO: aren't transitions
 		CheckEqual,
 		CheckSection,
+		CheckCrow,
 	}
 
 	for _, checkfunc := range checkfuncs {
-		if check, element, contents := checkfunc(row); check {
-			return lex.Line{
+		if check, element, contents := checkfunc(row); check && state.allowsStructure(element, row) {
+			line := lex.Line{
 				Type:     element,
 				Contents: strings.TrimSpace(contents),
 			}
+			if element == lex.TypeScene {
+				line.Contents, line.SceneNumber = lex.SplitSceneNumber(line.Contents)
+			}
+			return line
 		}
 	}
 
 	return lex.Line{}
 }
 
+// allowsStructure checks the context a structural element needs. Scene headings and transitions
+// that aren't forced need a blank row before and after them. Inside dialogue, rows starting
+// with = or # are dialogue instead of synopses and sections.
+func (state *ParseState) allowsStructure(element, row string) bool {
+	switch element {
+	case lex.TypeScene:
+		return strings.HasPrefix(row, ".") || state.blankBefore && state.blankAfter
+	case lex.TypeTrans:
+		return strings.HasPrefix(strings.TrimSpace(row), ">") || state.blankBefore && state.blankAfter
+	case "synopse", "section":
+		return !state.inDialogueContext
+	default:
+		return true
+	}
+}
+
 func (state *ParseState) checkInferredTypes(row, trimmedSpaceRow string) (lex.Line, bool) {
 	var currentLine lex.Line
 	var isCurrentLineDualSpeakerCandidate bool
 
 	charcheck := strings.Split(row, "(")
-	if len(charcheck) > 0 && strings.ToUpper(charcheck[0]) == charcheck[0] && strings.TrimSpace(charcheck[0]) != "" {
+	last := state.paragraph()
+	if last != nil && last.Type == lex.TypeAction {
+		// Action continues until the next blank row, even with rows that look like a speaker
+		currentLine.Type = lex.TypeAction
+		currentLine.Contents = strings.TrimRightFunc(row, unicode.IsSpace)
+	} else if state.blankBefore && len(charcheck) > 0 && strings.ToUpper(charcheck[0]) == charcheck[0] &&
+		strings.TrimSpace(charcheck[0]) != "" {
 		// Speaker name (all caps)
 		currentLine.Type = lex.TypeSpeaker
+		currentLine.Contents, isCurrentLineDualSpeakerCandidate = dualSpeaker(trimmedSpaceRow)
+	} else if state.inDialogueContext && strings.HasPrefix(trimmedSpaceRow, `\`) && escapedDialogue(trimmedSpaceRow) {
+		// Dialogue written like a parenthetical or transition, escaped with a backslash
+		currentLine.Type = lex.TypeDialog
+		currentLine.Contents = trimmedSpaceRow[1:]
+	} else if isParenthetical(trimmedSpaceRow) {
+		// Parenthetical, or action keeping its indentation outside of dialogue
+		currentLine.Type = lex.TypeParen
 		currentLine.Contents = trimmedSpaceRow
-		if strings.HasSuffix(currentLine.Contents, "^") {
-			isCurrentLineDualSpeakerCandidate = true
-			currentLine.Contents = strings.TrimRight(currentLine.Contents, " ^")
-		}
-	} else if len(row) > 1 && row[0] == '(' && row[len(row)-1] == ')' {
-		// Parenthetical
-		if state.inDialogueContext {
-			currentLine.Type = lex.TypeParen
-		} else {
+		if !state.inDialogueContext {
 			currentLine.Type = lex.TypeAction
+			currentLine.Contents = strings.TrimRightFunc(row, unicode.IsSpace)
 		}
-		currentLine.Contents = trimmedSpaceRow
 	} else if state.inDialogueContext {
 		// Dialogue
 		currentLine.Type = lex.TypeDialog
 		currentLine.Contents = trimmedSpaceRow
 	} else {
-		// Action
+		// Action keeps its indentation
 		currentLine.Type = lex.TypeAction
-		currentLine.Contents = trimmedSpaceRow
+		currentLine.Contents = strings.TrimRightFunc(row, unicode.IsSpace)
 	}
 
 	return currentLine, isCurrentLineDualSpeakerCandidate
 }
 
+// isParenthetical returns true if a row without surrounding white space is written like a parenthetical
+func isParenthetical(row string) bool {
+	return len(row) > 1 && row[0] == '(' && row[len(row)-1] == ')'
+}
+
+// escapedDialogue returns true if a row of dialogue without surrounding white space needs a backslash in front,
+// as it would be read as a parenthetical, transition or centered text, or starts with a backslash for that.
+// Indenting doesn't help for those, unlike for the other elements.
+func escapedDialogue(row string) bool {
+	row = strings.TrimLeft(row, `\`)
+	return isParenthetical(row) || strings.HasPrefix(row, ">")
+}
+
+// paragraph returns the last element if it is action, dialogue or lyrics on the previous row,
+// so that the current row can continue it. It returns nil otherwise.
+func (state *ParseState) paragraph() *lex.Line {
+	if len(state.out) == 0 {
+		return nil
+	}
+	last := &state.out[len(state.out)-1]
+	switch last.Type {
+	case lex.TypeAction, lex.TypeDialog, lex.TypeLyrics:
+		if last.Pos.EndLine == state.pos.Line-1 {
+			return last
+		}
+	}
+	return nil
+}
+
+// continueParagraph adds the current row to the previous element if it continues its paragraph.
+// Paragraphs spanning multiple rows are kept as a single element with newlines between the rows.
+func (state *ParseState) continueParagraph(currentLine lex.Line) bool {
+	last := state.paragraph()
+	if last == nil || last.Type != currentLine.Type {
+		return false
+	}
+	last.Contents += "\n" + currentLine.Contents
+	last.Pos.EndLine, last.Pos.EndCol = currentLine.Pos.EndLine, currentLine.Pos.EndCol
+	return true
+}
+
 func (state *ParseState) handleDualDialogue(currentLine lex.Line, isCurrentLineDualSpeakerCandidate bool,
 	i, totalLines int) {
 	// Handle dual dialogue closing
 	if state.inDualDialogue && state.shouldCloseDualDialogue(currentLine, isCurrentLineDualSpeakerCandidate,
 		i, totalLines) {
-		state.out = append(state.out, lex.Line{Type: lex.TypeDualClose})
+		state.out = append(state.out, lex.Line{Type: lex.TypeDualClose, Pos: state.pos})
 		state.inDualDialogue = false
 	}
 
 	// Handle dual dialogue opening/next
 	if isCurrentLineDualSpeakerCandidate {
 		if !state.inDualDialogue {
-			state.insertDualDialogueOpen()
-			state.inDualDialogue = true
-			state.out = append(state.out, lex.Line{Type: lex.TypeDualNext})
+			if state.insertDualDialogueOpen() {
+				state.inDualDialogue = true
+				state.out = append(state.out, lex.Line{Type: lex.TypeDualNext, Pos: state.pos})
+			}
 		} else {
 			// Close current dual dialogue and treat as regular speaker
-			state.out = append(state.out, lex.Line{Type: lex.TypeDualClose})
+			state.out = append(state.out, lex.Line{Type: lex.TypeDualClose, Pos: state.pos})
 			state.inDualDialogue = false
 		}
 	}
@@ -361,27 +620,22 @@ func (state *ParseState) shouldCloseDualDialogue(currentLine lex.Line, isCurrent
 	}
 }
 
-func (state *ParseState) insertDualDialogueOpen() {
-	foundOpenInsertPoint := false
+// insertDualDialogueOpen opens a dual dialogue before the speaker of the speech right before
+// the current row. It returns false if there is no such speech, the current speaker then isn't
+// part of a dual dialogue.
+func (state *ParseState) insertDualDialogueOpen() bool {
 	for j := len(state.out) - 1; j >= 0; j-- {
-		if state.out[j].Type == lex.TypeSpeaker {
-			for k := j; k >= 0; k-- {
-				if state.out[k].Type == lex.TypeEmpty {
-					dualOpen := []lex.Line{{Type: lex.TypeDualOpen}}
-					state.out = append(state.out[:k+1], append(dualOpen, state.out[k+1:]...)...)
-					foundOpenInsertPoint = true
-					break
-				} else if k == 0 {
-					state.out = append([]lex.Line{{Type: lex.TypeDualOpen}}, state.out...)
-					foundOpenInsertPoint = true
-					break
-				}
-			}
-			if foundOpenInsertPoint {
-				break
-			}
+		switch line := state.out[j]; {
+		case line.Type == lex.TypeSpeaker:
+			dualOpen := lex.Line{Type: lex.TypeDualOpen, Pos: line.Pos}
+			state.out = append(state.out[:j], append([]lex.Line{dualOpen}, state.out[j:]...)...)
+			return true
+		case line.Type != lex.TypeEmpty && line.Type != lex.TypeDialog && line.Type != lex.TypeParen &&
+			!line.IsAnnotation():
+			return false
 		}
 	}
+	return false
 }
 
 func (state *ParseState) shouldAppendLine(currentLine lex.Line, trimmedSpaceRow string, i, totalLines int) bool {
@@ -402,12 +656,26 @@ func (state *ParseState) updateDialogueContext(currentLine lex.Line) {
 	} else if currentLine.Type == lex.TypeEmpty {
 		// Revert speaker to action if followed only by empty line
 		if len(state.out) >= 2 && state.out[len(state.out)-2].Type == lex.TypeSpeaker && !state.inDualDialogue {
-			state.out[len(state.out)-2].Type = lex.TypeAction
-			state.inDialogueContext = false
-		} else {
-			state.inDialogueContext = false
+			state.revertSpeaker()
 		}
+		state.inDialogueContext = false
 	} else {
 		state.inDialogueContext = false
 	}
 }
+
+// revertSpeaker turns the speaker before the current blank row into action, as no dialogue
+// follows it. Action right on the row before it is continued instead.
+func (state *ParseState) revertSpeaker() {
+	k := len(state.out) - 2
+	speaker := &state.out[k]
+	speaker.Type = lex.TypeAction
+	if k == 0 {
+		return
+	}
+	if last := &state.out[k-1]; last.Type == lex.TypeAction && last.Pos.EndLine == speaker.Pos.Line-1 {
+		last.Contents += "\n" + speaker.Contents
+		last.Pos.EndLine, last.Pos.EndCol = speaker.Pos.EndLine, speaker.Pos.EndCol
+		state.out = append(state.out[:k], state.out[k+1:]...)
+	}
+}
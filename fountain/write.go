@@ -3,6 +3,8 @@ package fountain
 import (
 	"fmt"
 	"io"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/LaPingvino/lexington/lex"
@@ -11,6 +13,9 @@ import (
 // FountainWriter implements the writer.Writer interface for Fountain output.
 type FountainWriter struct {
 	SceneConfig []string // Configuration for scene headers
+	Reformat    bool     // Write every element anew, ignoring the source text kept by ParsePreserving
+	AlignTitle  bool     // Pad the title page keys so their values start in the same column
+	ForceAll    bool     // Force every scene heading, transition, speaker and action, also where it isn't needed
 }
 
 // WriteState holds the state needed during writing
@@ -18,29 +23,200 @@ type WriteState struct {
 	titlepage string
 	writer    io.Writer
 	config    []string
+	preserve  bool       // Unchanged elements are written as their source text
+	force     bool       // Force every element that can be forced
+	keyWidth  int        // Width title page keys are padded to, including the colon
+	preserved bool       // The element owning the current source rows was written as its source text
+	inline    []lex.Line // The notes and boneyard written inside the text of the current element
+	dualNext  bool       // The next speaker is the second one of a dual dialogue
+	prev      lex.Line   // The element written on the rows before, the zero line at the start
+	next      lex.Line   // The element written on the rows after, the zero line at the end
 }
 
 // Write converts the internal lex.Screenplay format to a Fountain file.
+// Elements that would be parsed as something else are forced with >, ., @, ! or ~,
+// so parsing the written file gives the same screenplay again.
 // It implements the writer.Writer interface.
 func (f *FountainWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
-	// Remove trailing empty line if present
-	screenplay = f.trimTrailingEmpty(screenplay)
-
 	state := &WriteState{
 		titlepage: "start",
 		writer:    w,
 		config:    f.SceneConfig,
+		preserve:  !f.Reformat,
+		force:     f.ForceAll,
+	}
+	if f.AlignTitle {
+		for _, key := range screenplay.TitlePage() {
+			if !strings.Contains(key.Contents, "\n") {
+				state.keyWidth = max(state.keyWidth, len(key.Type)+1)
+			}
+		}
 	}
 
-	for _, line := range screenplay {
+	// Blank rows or a key at the start would be read as part of a title page
+	if first := nextWritten(screenplay); first.Type != lex.TypeTitlePage && !state.fromSource(first) &&
+		(first.Type == lex.TypeEmpty || strings.Contains(firstRow(first.Text()), ":")) {
+		if _, err := fmt.Fprint(w, "\n\n"); err != nil {
+			return err
+		}
+	}
+	// Remove trailing empty line if present, it is still taken into account as the next element.
+	// An unchanged blank row at the end of the source is kept.
+	all := screenplay
+	if n := len(screenplay); n == 0 || !state.fromSource(screenplay[n-1]) || screenplay[n-1].Source.Text == "" {
+		screenplay = f.trimTrailingEmpty(screenplay)
+	}
+
+	for i := 0; i < len(screenplay); i++ {
+		line := screenplay[i]
+		state.next = nextWritten(all[i+1:])
+		state.inline = inlineAfter(line, screenplay[i+1:])
 		if err := state.writeLine(line); err != nil {
 			return err
 		}
+		if isWritten(line) {
+			state.prev = line
+		}
+		i += len(state.inline)
 	}
 
 	return nil
 }
 
+// isWritten returns true for the elements written on rows of their own that the parser
+// takes into account when it looks at the rows around an element
+func isWritten(line lex.Line) bool {
+	return line.Type != lex.TypeRevision && !line.IsDualDialogueMarker() && !line.IsAnnotation()
+}
+
+// nextWritten returns the first element of the screenplay that is written, or the zero line
+func nextWritten(screenplay lex.Screenplay) lex.Line {
+	for _, line := range screenplay {
+		if isWritten(line) {
+			return line
+		}
+	}
+	return lex.Line{}
+}
+
+// inlineAfter returns the notes and boneyard following a line that are written inside its text
+func inlineAfter(line lex.Line, rest lex.Screenplay) lex.Screenplay {
+	if !hasInlineText(line.Type) {
+		return nil
+	}
+	n := 0
+	for n < len(rest) && rest[n].IsAnnotation() && rest[n].Inline {
+		n++
+	}
+	return rest[:n]
+}
+
+// annotate puts the inline notes and boneyard back into the rows written for the text of the
+// current element. A note at the end of a row is written after a space.
+func (state *WriteState) annotate(text string, rows []string) {
+	if len(state.inline) == 0 {
+		return
+	}
+	plain := slices.Clone(rows)
+	starts := make([]int, len(rows))
+	for i, row := range strings.Split(text, "\n")[:len(rows)-1] {
+		starts[i+1] = starts[i] + len(row) + 1
+	}
+	for i := len(state.inline) - 1; i >= 0; i-- {
+		note := state.inline[i]
+		k := max(sort.Search(len(starts), func(k int) bool { return starts[k] > note.Offset })-1, 0)
+		row := plain[k]
+		at := min(max(note.Offset-starts[k], 0), len(row))
+		text := "[[" + note.Contents + "]]"
+		if note.Type == lex.TypeBoneyard {
+			text = "/*" + note.Contents + "*/"
+		}
+		if at == len(row) && strings.TrimSpace(row) != "" && !strings.HasSuffix(row, " ") {
+			text = " " + text
+		}
+		rows[k] = rows[k][:at] + text + rows[k][at:]
+	}
+}
+
+// annotated returns the text of an element written on a single row with its inline notes and boneyard
+func (state *WriteState) annotated(text string) string {
+	rows := []string{text}
+	state.annotate(text, rows)
+	return rows[0]
+}
+
+// firstRow returns the first row of a text spanning multiple rows
+func firstRow(text string) string {
+	row, _, _ := strings.Cut(text, "\n")
+	return row
+}
+
+// fromSource returns true if the line is written as the source text it was read from
+func (state *WriteState) fromSource(line lex.Line) bool {
+	return state.preserve && line.Unchanged()
+}
+
+// writeSource returns true if the line is written as its source text. Lines sharing their rows
+// with the line before them are only written that way if that line is, otherwise they are
+// written anew like changed lines. Dual dialogue markers are always handled as usual, as the
+// caret is written with the speaker.
+func (state *WriteState) writeSource(line lex.Line) bool {
+	if line.Source == nil || !state.preserve || line.IsDualDialogueMarker() {
+		return false
+	}
+	if line.Source.Text != "" {
+		state.preserved = line.Unchanged()
+	}
+	if !state.preserved || !line.Unchanged() {
+		return false
+	}
+	if line.Type == lex.TypeSpeaker {
+		state.dualNext = false
+	}
+	return true
+}
+
+// blankBefore returns true if the current element follows a blank row or starts the screenplay
+func (state *WriteState) blankBefore() bool {
+	switch state.prev.Type {
+	case "", lex.TypeEmpty, lex.TypeNewPage:
+		return true
+	default:
+		return false
+	}
+}
+
+// blankAround returns true if the current element is written between blank rows, which scene
+// headings and transitions need to be recognized without a forcing character
+func (state *WriteState) blankAround() bool {
+	return state.blankBefore() && (state.next.Type == "" || state.next.Type == lex.TypeEmpty)
+}
+
+// misread returns true if a row would be parsed as a forced element or as a scene heading,
+// transition, centered text, synopsis, section or page break
+func misread(row string) bool {
+	ok, _, _ := CheckCrow(row)
+	return ok || misreadAsOther(row)
+}
+
+// misreadAsOther returns true if a row would be parsed as a forced element or as a scene heading,
+// synopsis, section or page break, which are checked before transitions
+func misreadAsOther(row string) bool {
+	for _, check := range []func(string) (bool, string, string){CheckForce, CheckScene, CheckSection} {
+		if ok, _, _ := check(row); ok {
+			return true
+		}
+	}
+	ok, element, _ := CheckEqual(row)
+	return ok || element == lex.TypeNewPage
+}
+
+// looksLikeSpeaker returns true if a row after a blank row would be parsed as a speaker
+func looksLikeSpeaker(row string) bool {
+	name, _, _ := strings.Cut(row, "(")
+	return strings.ToUpper(name) == name && strings.TrimSpace(name) != ""
+}
+
 func (f *FountainWriter) trimTrailingEmpty(screenplay lex.Screenplay) lex.Screenplay {
 	if len(screenplay) > 0 && screenplay[len(screenplay)-1].Type == lex.TypeEmpty {
 		return screenplay[:len(screenplay)-1]
@@ -49,13 +225,25 @@ func (f *FountainWriter) trimTrailingEmpty(screenplay lex.Screenplay) lex.Screen
 }
 
 func (state *WriteState) writeLine(line lex.Line) error {
+	// Fountain has no syntax for revisions
+	if line.Type == lex.TypeRevision {
+		return nil
+	}
 	element := line.Type
-	if state.titlepage == "start" && line.Type != lex.TypeTitlePage {
+	if state.titlepage == "start" && line.Type != lex.TypeTitlePage && !line.IsAnnotation() {
 		state.titlepage = ""
 	}
-	if state.titlepage != "" {
+	// Notes and boneyard can be anywhere, also in the title page
+	if state.titlepage != "" && !line.IsAnnotation() {
 		element = state.titlepage
 	}
+	if element != "start" && state.writeSource(line) {
+		if element == lex.TypeTitlePage && line.Type == lex.TypeNewPage {
+			state.titlepage = ""
+		}
+		_, err := io.WriteString(state.writer, line.Source.Text)
+		return err
+	}
 
 	switch element {
 	case "start":
@@ -64,9 +252,15 @@ func (state *WriteState) writeLine(line lex.Line) error {
 	case lex.TypeTitlePage:
 		return state.writeTitlePageLine(line)
 	case lex.TypeNewPage:
-		return state.writeNewPage()
+		return state.writeNewPage(line)
 	case lex.TypeEmpty:
 		return state.writeEmpty()
+	case lex.TypeDualOpen, lex.TypeDualClose:
+		// Dual dialogue is marked by the caret after the second speaker only
+		return nil
+	case lex.TypeDualNext:
+		state.dualNext = true
+		return nil
 	case lex.TypeSpeaker:
 		return state.writeSpeaker(line)
 	case lex.TypeScene:
@@ -75,27 +269,57 @@ func (state *WriteState) writeLine(line lex.Line) error {
 		return state.writeLyrics(line)
 	case lex.TypeAction:
 		return state.writeAction(line)
+	case lex.TypeDialog:
+		return state.writeDialog(line)
+	case lex.TypeTrans:
+		return state.writeTrans(line)
+	case lex.TypeCenter:
+		_, err := fmt.Fprintf(state.writer, "> %s <\n", state.annotated(line.Contents))
+		return err
+	case lex.TypeNote:
+		_, err := fmt.Fprintf(state.writer, "[[%s]]\n", line.Contents)
+		return err
+	case lex.TypeBoneyard:
+		_, err := fmt.Fprintf(state.writer, "/*%s*/\n", line.Contents)
+		return err
+	case "synopse":
+		_, err := fmt.Fprintf(state.writer, "= %s\n", state.annotated(line.Contents))
+		return err
 	default:
 		return state.writeDefault(line)
 	}
 }
 
+// titleIndent indents the rows of title page values spanning multiple lines
+const titleIndent = "    "
+
 func (state *WriteState) writeTitlePageLine(line lex.Line) error {
-	if line.Type == "metasection" {
+	if line.Type == lex.TypeMetaSection {
 		return nil
 	}
 	if line.Type == lex.TypeNewPage {
-		if _, err := fmt.Fprintln(state.writer, ""); err != nil {
-			return err
-		}
 		state.titlepage = ""
-		return nil
+		// The end of the file ends the title page as well
+		if state.next.Type == "" {
+			return nil
+		}
+		_, err := fmt.Fprintln(state.writer, "")
+		return err
+	}
+	if strings.Contains(line.Contents, "\n") {
+		value := titleIndent + strings.ReplaceAll(line.Contents, "\n", "\n"+titleIndent)
+		_, err := fmt.Fprintf(state.writer, "%s:\n%s\n", line.Type, value)
+		return err
 	}
-	_, err := fmt.Fprintf(state.writer, "%s: %s\n", line.Type, line.Contents)
+	_, err := fmt.Fprintf(state.writer, "%-*s %s\n", state.keyWidth, line.Type+":", line.Contents)
 	return err
 }
 
-func (state *WriteState) writeNewPage() error {
+func (state *WriteState) writeNewPage(line lex.Line) error {
+	if line.Contents != "" {
+		_, err := fmt.Fprintf(state.writer, "=== #%s#\n", line.Contents)
+		return err
+	}
 	_, err := fmt.Fprintln(state.writer, "===")
 	return err
 }
@@ -106,22 +330,36 @@ func (state *WriteState) writeEmpty() error {
 }
 
 func (state *WriteState) writeSpeaker(line lex.Line) error {
-	if line.Contents != strings.ToUpper(line.Contents) {
-		if _, err := fmt.Fprint(state.writer, "@"); err != nil {
-			return err
-		}
+	text := line.Text()
+	row := state.annotated(text)
+	if state.dualNext {
+		state.dualNext = false
+		text += " ^"
+		row += " ^"
 	}
-	_, err := fmt.Fprintln(state.writer, line.Contents)
+	// Only the name has to be upper case, extensions like (cont'd) may be written in any case
+	if state.force || line.Contents != strings.ToUpper(line.Contents) || !looksLikeSpeaker(text) || misread(text) ||
+		!state.blankBefore() {
+		row = "@" + row
+	}
+	_, err := fmt.Fprintln(state.writer, row)
 	return err
 }
 
 func (state *WriteState) writeScene(line lex.Line) error {
-	if !state.isSceneSupported(line.Contents) {
-		if _, err := fmt.Fprint(state.writer, "."); err != nil {
-			return err
-		}
+	row := state.annotated(line.Contents)
+	if line.SceneNumber != "" {
+		row += " #" + line.SceneNumber + "#"
 	}
-	_, err := fmt.Fprintln(state.writer, line.Contents)
+	switch {
+	case strings.HasPrefix(line.Contents, "."):
+		// Two periods don't force a scene heading, a space in between does
+		row = ". " + row
+	case state.force || !state.isSceneSupported(line.Contents) || line.Contents != strings.ToUpper(line.Contents) ||
+		!state.blankAround():
+		row = "." + row
+	}
+	_, err := fmt.Fprintln(state.writer, row)
 	return err
 }
 
@@ -136,21 +374,76 @@ func (state *WriteState) isSceneSupported(contents string) bool {
 }
 
 func (state *WriteState) writeLyrics(line lex.Line) error {
-	_, err := fmt.Fprintf(state.writer, "~%s\n", line.Contents)
+	rows := paragraphRows(line.Contents)
+	state.annotate(line.Contents, rows)
+	_, err := fmt.Fprintf(state.writer, "~%s\n", strings.Join(rows, "\n~"))
+	return err
+}
+
+// writeTrans writes a transition, forced with > unless it is written in capitals ending in TO:
+// between blank rows and doesn't look like another element
+func (state *WriteState) writeTrans(line lex.Line) error {
+	row := state.annotated(line.Contents)
+	crow, element, text := CheckCrow(line.Contents)
+	if !state.force && crow && element == lex.TypeTrans && text == line.Contents && !strings.HasPrefix(text, ">") &&
+		state.blankAround() && !misreadAsOther(line.Contents) {
+		_, err := fmt.Fprintln(state.writer, row)
+		return err
+	}
+	_, err := fmt.Fprintf(state.writer, "> %s\n", row)
 	return err
 }
 
+// writeAction writes action, forcing the rows that would be read as another element with !
 func (state *WriteState) writeAction(line lex.Line) error {
-	if line.Contents == strings.ToUpper(line.Contents) {
-		if _, err := fmt.Fprint(state.writer, "!"); err != nil {
-			return err
+	rows := paragraphRows(line.Contents)
+	plain := slices.Clone(rows)
+	state.annotate(line.Contents, rows)
+	for i, row := range plain {
+		if misread(row) || i == 0 && (state.force || looksLikeSpeaker(row) ||
+			state.prev.IsDialogueElement() && !state.blankBefore()) {
+			rows[i] = "!" + rows[i]
+		}
+	}
+	_, err := fmt.Fprintln(state.writer, strings.Join(rows, "\n"))
+	return err
+}
+
+// writeDialog writes dialogue, indenting the rows that would be read as another element.
+// Rows written like a parenthetical or transition get a backslash in front, which the parser removes again.
+func (state *WriteState) writeDialog(line lex.Line) error {
+	rows := paragraphRows(line.Contents)
+	plain := slices.Clone(rows)
+	state.annotate(line.Contents, rows)
+	for i, row := range plain {
+		switch {
+		case escapedDialogue(strings.TrimSpace(row)):
+			rows[i] = `\` + rows[i]
+		case misread(row):
+			rows[i] = " " + rows[i]
 		}
 	}
-	_, err := fmt.Fprintln(state.writer, line.Contents)
+	_, err := fmt.Fprintln(state.writer, strings.Join(rows, "\n"))
 	return err
 }
 
 func (state *WriteState) writeDefault(line lex.Line) error {
-	_, err := fmt.Fprintln(state.writer, line.Contents)
+	rows := paragraphRows(line.Contents)
+	state.annotate(line.Contents, rows)
+	_, err := fmt.Fprintln(state.writer, strings.Join(rows, "\n"))
 	return err
 }
+
+// heldBlank is written for blank rows inside a paragraph, two spaces keep the paragraph together
+const heldBlank = "  "
+
+// paragraphRows splits the contents of an element spanning multiple rows, replacing blank rows with heldBlank
+func paragraphRows(contents string) []string {
+	rows := strings.Split(contents, "\n")
+	for i, row := range rows {
+		if strings.TrimSpace(row) == "" && len(rows) > 1 {
+			rows[i] = heldBlank
+		}
+	}
+	return rows
+}
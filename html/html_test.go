@@ -244,6 +244,9 @@ func TestProcessInlineMarkupFunction(t *testing.T) {
 		{"Single asterisk", "*", "*"},
 		{"Single underscore", "_", "_"},
 		{"Nested asterisks", "****bold****", "<i><b><i>bold</i></b></i>"},
+		{"Nested markup", "_**bold underlined**_", "<u><b>bold underlined</b></u>"},
+		{"Escaped markup", `\*not italic\*`, "*not italic*"},
+		{"Escaped HTML", "a < b & *c*", "a &lt; b &amp; <i>c</i>"},
 	}
 
 	for _, test := range tests {
@@ -265,3 +268,64 @@ func TestInlineMarkupWithoutMarkupChars(t *testing.T) {
 		t.Errorf("processInlineMarkup should return unchanged text when no markup characters present")
 	}
 }
+
+// TestNotesHTML checks that notes and boneyard follow the Hide setting of the element rules.
+func TestNotesHTML(t *testing.T) {
+	screenplay := lex.Screenplay{
+		lex.Line{Type: lex.TypeAction, Contents: "Mary enters."},
+		lex.Line{Type: lex.TypeNote, Contents: "Check the lighting"},
+		lex.Line{Type: lex.TypeBoneyard, Contents: "Cut scene"},
+	}
+
+	var buffer bytes.Buffer
+	writer := &HTMLWriter{Elements: rules.Default}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("HTMLWriter.Write returned an unexpected error: %v", err)
+	}
+	if strings.Contains(buffer.String(), "Check the lighting") || strings.Contains(buffer.String(), "Cut scene") {
+		t.Errorf("Notes and boneyard should be hidden by default")
+	}
+
+	shown := rules.Set{
+		"action":   rules.Default["action"],
+		"note":     rules.Format{Left: 1.5, Right: 1},
+		"boneyard": rules.Format{Left: 1.5, Right: 1},
+	}
+	buffer.Reset()
+	writer = &HTMLWriter{Elements: shown}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("HTMLWriter.Write returned an unexpected error: %v", err)
+	}
+	for _, substr := range []string{
+		`<div class="note">Check the lighting</div>`,
+		`<div class="boneyard">Cut scene</div>`,
+	} {
+		if !strings.Contains(buffer.String(), substr) {
+			t.Errorf("Expected %q in the output when notes are shown", substr)
+		}
+	}
+}
+
+func TestPageSizeHTML(t *testing.T) {
+	screenplay := lex.Screenplay{lex.Line{Type: lex.TypeAction, Contents: "Mary enters."}}
+
+	var buffer bytes.Buffer
+	writer := &HTMLWriter{Elements: rules.Default, Page: rules.Page{Size: "A4"}}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("HTMLWriter.Write returned an unexpected error: %v", err)
+	}
+	for _, substr := range []string{"size: A4;", "max-width: 8.27in;", "margin-right: 0.77in;"} {
+		if !strings.Contains(buffer.String(), substr) {
+			t.Errorf("Expected %q in the output for A4 paper", substr)
+		}
+	}
+
+	buffer.Reset()
+	writer = &HTMLWriter{Elements: rules.Default, Page: rules.Page{Width: 6, Height: 9}}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("HTMLWriter.Write returned an unexpected error: %v", err)
+	}
+	if !strings.Contains(buffer.String(), "size: 6in 9in;") {
+		t.Errorf("Expected a custom page size in the output")
+	}
+}
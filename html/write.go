@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"html/template"
 	"io"
-	"regexp"
 	"strings"
 
+	"github.com/LaPingvino/lexington/internal"
 	"github.com/LaPingvino/lexington/lex"
 	"github.com/LaPingvino/lexington/rules"
 )
@@ -14,32 +14,46 @@ import (
 // HTMLWriter implements the writer.Writer interface for HTML output.
 // It uses a rules.Set for configurable formatting elements.
 type HTMLWriter struct {
-	Elements rules.Set // Configuration for elements (margins, fonts, etc.)
+	Elements rules.Set  // Configuration for elements (margins, fonts, etc.)
+	Page     rules.Page // Paper size for printing
 }
 
-// Inline markup patterns for HTML output
-var (
-	bolditalic = regexp.MustCompile(`\*{3}([^\*\n]+)\*{3}`)
-	bold       = regexp.MustCompile(`\*{2}([^\*\n]+)\*{2}`)
-	italic     = regexp.MustCompile(`\*{1}([^\*\n]+)\*{1}`)
-	underline  = regexp.MustCompile(`_{1}([^\*\n]+)_{1}`)
-)
+// htmlTags are the tags for the emphasis styles, outermost first
+var htmlTags = []struct {
+	style lex.Style
+	tag   string
+}{
+	{lex.Bold, "b"},
+	{lex.Italic, "i"},
+	{lex.Underline, "u"},
+}
 
-// processInlineMarkup converts fountain-style inline markup to HTML
+// processInlineMarkup converts fountain-style inline markup to HTML, escaping the text
 func processInlineMarkup(text string) template.HTML {
-	// Only process if the text contains markup characters
-	if !strings.ContainsAny(text, "*_") {
-		return template.HTML(text)
-	}
-
-	// Apply replacements in order: bold+italic first, then bold, then italic, then underline
-	// This prevents conflicts between overlapping patterns
-	text = bolditalic.ReplaceAllString(text, "<b><i>$1</i></b>")
-	text = bold.ReplaceAllString(text, "<b>$1</b>")
-	text = italic.ReplaceAllString(text, "<i>$1</i>")
-	text = underline.ReplaceAllString(text, "<u>$1</u>")
+	var b strings.Builder
+	writeSpans(&b, lex.ParseMarkup(text))
+	return template.HTML(b.String())
+}
 
-	return template.HTML(text)
+// writeSpans writes a tree of inline markup spans as nested HTML tags
+func writeSpans(b *strings.Builder, spans []lex.Span) {
+	for _, span := range spans {
+		if span.Style == 0 {
+			b.WriteString(template.HTMLEscapeString(span.Text))
+			continue
+		}
+		for _, t := range htmlTags {
+			if span.Style.Has(t.style) {
+				b.WriteString("<" + t.tag + ">")
+			}
+		}
+		writeSpans(b, span.Children)
+		for i := len(htmlTags) - 1; i >= 0; i-- {
+			if span.Style.Has(htmlTags[i].style) {
+				b.WriteString("</" + htmlTags[i].tag + ">")
+			}
+		}
+	}
 }
 
 // htmlTemplateString is the template for HTML output with configurable CSS
@@ -61,7 +75,7 @@ body {
 .page {
     margin: {{.Config.PageMargins}};
     min-height: 9in;
-    max-width: 8.5in;
+    max-width: {{.Config.PageWidth}}in;
     margin-left: auto;
     margin-right: auto;
 }
@@ -73,12 +87,22 @@ body {
     margin-top: 1.5em;
     margin-bottom: 1em;
 }
+.scene-number {
+    float: left;
+    margin-left: -0.75in;
+}
+.scene-number-right {
+    float: right;
+    margin-left: 0;
+    margin-right: -0.75in;
+}
 .action, .general {
     margin-left: {{.Config.ActionLeft}}in;
     margin-right: {{.Config.ActionRight}}in;
     margin-top: 1em;
     margin-bottom: 1em;
     text-align: justify;
+    white-space: pre-wrap;
 }
 .speaker {
     text-transform: uppercase;
@@ -91,6 +115,7 @@ body {
     margin-left: {{.Config.DialogLeft}}in;
     margin-right: {{.Config.DialogRight}}in;
     text-align: left;
+    white-space: pre-wrap;
 }
 .parenthetical {
     margin-left: {{.Config.ParenLeft}}in;
@@ -109,12 +134,24 @@ body {
     height: 1em;
 }
 .title-page {
-	text-align: center;
 	height: 100vh;
 	display: flex;
 	flex-direction: column;
+}
+.title-page-center {
+	flex: 1;
+	display: flex;
+	flex-direction: column;
 	justify-content: center;
-	align-items: center;
+	text-align: center;
+}
+.title-page-bottom {
+	display: flex;
+	justify-content: space-between;
+	align-items: flex-end;
+}
+.title-page-right {
+	text-align: right;
 }
 .title-page h1 {
 	margin-bottom: 1em;
@@ -150,11 +187,29 @@ body {
 	margin-left: {{.Config.DualParenLeft}}in;
 	margin-right: {{.Config.DualParenRight}}in;
 }
+.note {
+    font-style: italic;
+    color: #555;
+    background-color: #ffffcc;
+    margin-left: {{.Config.NoteLeft}}in;
+    margin-right: {{.Config.NoteRight}}in;
+}
+.boneyard {
+    white-space: pre-wrap;
+    color: #888;
+    text-decoration: line-through;
+    margin-left: {{.Config.ActionLeft}}in;
+    margin-right: {{.Config.ActionRight}}in;
+}
 .lyrics {
     {{.Config.LyricsStyle}}
     margin-left: {{.Config.LyricsLeft}}in;
     margin-right: {{.Config.LyricsRight}}in;
     text-align: left;
+    white-space: pre-wrap;
+}
+@page {
+    size: {{.Config.PageSize}};
 }
 @media print {
     .newpage {
@@ -164,26 +219,38 @@ body {
 </style>
 </head>
 <body>
+{{- with .TitlePage}}
 <div class="page">
-{{- range .Screenplay -}}
-    {{- if eq .Type "titlepage" -}}
-<div class="title-page">{{-
-    else if eq .Type "Title" -}}
-<h1>{{- processInlineMarkup .Contents -}}</h1>{{-
+<div class="title-page">
+<div class="title-page-center">
+{{- range .Center -}}
+{{- if eq .Type "Title" -}}
+<h1>{{- titleText . -}}</h1>{{-
     else if eq .Type "Credit" -}}
-<p><em>{{- processInlineMarkup .Contents -}}</em></p>{{-
-    else if eq .Type "Author" -}}
-<p>{{- processInlineMarkup .Contents -}}</p>{{-
-    else if eq .Type "metasection" -}}
+<p><em>{{- titleText . -}}</em></p>{{-
+    else -}}
+<p>{{- titleText . -}}</p>{{- end -}}
+{{- end -}}
+</div>
+<div class="title-page-bottom">
+<div class="title-page-left">{{range .Left}}<p>{{titleText .}}</p>{{end}}</div>
+<div class="title-page-right">{{range .Right}}<p>{{titleText .}}</p>{{end}}</div>
+</div>
+</div>
 </div>
 <div class="newpage"></div>
-<div class="page">{{-
-    else if eq .Type "scene" -}}
-<div class="scene-heading">{{- processInlineMarkup .Contents -}}</div>{{-
+{{- end}}
+<div class="page">
+{{- range .Screenplay -}}
+    {{- if eq .Type "scene" -}}
+<div class="scene-heading">{{- if .SceneNumber -}}
+<span class="scene-number">{{ .SceneNumber }}</span>
+<span class="scene-number scene-number-right">{{ .SceneNumber }}</span>{{- end -}}
+{{- processInlineMarkup .Contents -}}</div>{{-
     else if eq .Type "action" "general" -}}
 <div class="action">{{- processInlineMarkup .Contents -}}</div>{{-
     else if eq .Type "speaker" -}}
-<div class="speaker">{{- processInlineMarkup .Contents -}}</div>{{-
+<div class="speaker">{{- processInlineMarkup .Text -}}</div>{{-
     else if eq .Type "dialog" -}}
 <div class="dialogue">{{- processInlineMarkup .Contents -}}</div>{{-
     else if eq .Type "lyrics" -}}
@@ -194,6 +261,10 @@ body {
 <div class="transition">{{- processInlineMarkup .Contents -}}</div>{{-
     else if eq .Type "center" -}}
 <div class="center">{{- processInlineMarkup .Contents -}}</div>{{-
+    else if eq .Type "note" -}}
+<div class="note">{{- processInlineMarkup .Contents -}}</div>{{-
+    else if eq .Type "boneyard" -}}
+<div class="boneyard">{{- .Contents -}}</div>{{-
     else if eq .Type "newpage" -}}
 </div>
 <div class="newpage"></div>
@@ -213,12 +284,50 @@ body {
 </html>
 `
 
-// HTMLTemplateData combines configuration and screenplay data for the template
+// HTMLTemplateData combines configuration and screenplay data for the template.
+// The screenplay doesn't include the title page, which is laid out separately.
 type HTMLTemplateData struct {
 	Config     TemplateConfig
+	TitlePage  *TitlePageData // Nil if the screenplay has no title page
 	Screenplay lex.Screenplay
 }
 
+// TitlePageData holds the keys of the title page by the block of the standard layout they go in
+type TitlePageData struct {
+	Center lex.Screenplay // Title, credit, author and source
+	Left   lex.Screenplay // Contact details and other keys, at the bottom left
+	Right  lex.Screenplay // Draft date, at the bottom right
+}
+
+// newTitlePageData sorts the keys of the title page into the blocks of the layout
+func newTitlePageData(screenplay lex.Screenplay) *TitlePageData {
+	keys := screenplay.TitlePage()
+	if len(keys) == 0 {
+		return nil
+	}
+	data := &TitlePageData{}
+	for _, key := range keys {
+		switch lex.TitlePlacement(key.Type) {
+		case lex.TitleCenter:
+			data.Center = append(data.Center, key)
+		case lex.TitleRight:
+			data.Right = append(data.Right, key)
+		default:
+			data.Left = append(data.Left, key)
+		}
+	}
+	return data
+}
+
+// titleText formats the value of a title page key, with a line break for every line of the value
+func titleText(line lex.Line) template.HTML {
+	var rows []string
+	for _, row := range strings.Split(line.TitleText(), "\n") {
+		rows = append(rows, string(processInlineMarkup(row)))
+	}
+	return template.HTML(strings.Join(rows, "<br>"))
+}
+
 // TemplateConfig holds the configuration values for the HTML template
 type TemplateConfig struct {
 	// Font configuration
@@ -227,6 +336,8 @@ type TemplateConfig struct {
 
 	// Page layout
 	PageMargins string
+	PageWidth   float64
+	PageSize    template.CSS // CSS page size, a name like A4 or width and height
 
 	// Element margins (in inches)
 	ActionLeft   float64
@@ -245,6 +356,8 @@ type TemplateConfig struct {
 	CenterRight  float64
 	LyricsLeft   float64
 	LyricsRight  float64
+	NoteLeft     float64
+	NoteRight    float64
 
 	// Dual dialogue configuration
 	DualDialogueWidth int
@@ -263,11 +376,20 @@ type TemplateConfig struct {
 }
 
 // getTemplateConfig creates TemplateConfig from rules configuration
-func (h *HTMLWriter) getTemplateConfig() TemplateConfig {
+func (h *HTMLWriter) getTemplateConfig() (TemplateConfig, error) {
 	elements := h.Elements
 	if elements == nil {
 		elements = rules.Default
 	}
+	width, height, err := h.Page.Dimensions()
+	if err != nil {
+		return TemplateConfig{}, err
+	}
+	elements = elements.ForWidth(width)
+	pageSize := template.CSS(fmt.Sprintf("%gin %gin", width, height))
+	if name := h.Page.SizeName(); name != "" {
+		pageSize = template.CSS(name)
+	}
 
 	// Get format configurations
 	action := elements.Get("action")
@@ -278,6 +400,7 @@ func (h *HTMLWriter) getTemplateConfig() TemplateConfig {
 	trans := elements.Get("trans")
 	center := elements.Get("center")
 	lyrics := elements.Get("lyrics")
+	note := elements.Get("note")
 
 	// Use industry standard margins directly - HTML can handle them
 	// The page width will be set appropriately to accommodate these margins
@@ -328,6 +451,8 @@ func (h *HTMLWriter) getTemplateConfig() TemplateConfig {
 
 		// Page layout
 		PageMargins: pageMargins,
+		PageWidth:   width,
+		PageSize:    pageSize,
 
 		// Element margins (industry standard)
 		ActionLeft:   htmlActionLeft,
@@ -346,6 +471,8 @@ func (h *HTMLWriter) getTemplateConfig() TemplateConfig {
 		CenterRight:  center.Right,
 		LyricsLeft:   lyrics.Left,
 		LyricsRight:  lyrics.Right,
+		NoteLeft:     note.Left,
+		NoteRight:    note.Right,
 
 		// Dual dialogue configuration
 		DualDialogueWidth: 100,
@@ -361,24 +488,39 @@ func (h *HTMLWriter) getTemplateConfig() TemplateConfig {
 		SceneStyle:  sceneStyle,
 		TransAlign:  transAlign,
 		LyricsStyle: lyricsStyle,
-	}
+	}, nil
 }
 
 // Write converts the internal lex.Screenplay format to a self-contained HTML file.
 // It implements the writer.Writer interface.
 func (h *HTMLWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
 	// Get template configuration from rules
-	config := h.getTemplateConfig()
+	config, err := h.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+
+	// Leave out notes and boneyard unless the configuration shows them
+	elements := h.Elements
+	if elements == nil {
+		elements = rules.Default
+	}
+	screenplay = internal.Filter(screenplay, func(line lex.Line) bool {
+		return !line.IsAnnotation() || !elements.Get(line.Type).Hide
+	})
 
 	// Create combined template data
+	body, _ := screenplay.SplitTitlePage()
 	templateData := HTMLTemplateData{
 		Config:     config,
-		Screenplay: screenplay,
+		TitlePage:  newTitlePageData(screenplay),
+		Screenplay: body,
 	}
 
 	// Parse and execute the HTML template with better error context
 	tmpl, err := template.New("screenplay").Funcs(template.FuncMap{
 		"processInlineMarkup": processInlineMarkup,
+		"titleText":           titleText,
 	}).Parse(htmlTemplateString)
 	if err != nil {
 		return fmt.Errorf("failed to parse HTML template: %w", err)
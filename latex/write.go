@@ -3,10 +3,10 @@ package latex
 import (
 	"fmt"
 	"io"
-	"regexp"
 	"strings"
 	"text/template"
 
+	"github.com/LaPingvino/lexington/internal"
 	"github.com/LaPingvino/lexington/lex"
 	"github.com/LaPingvino/lexington/rules"
 )
@@ -15,47 +15,45 @@ import (
 // It uses a Go text/template for rendering and requires a rules.Set
 // for formatting elements.
 type LaTeXWriter struct {
-	Template string    // Path to the LaTeX template file
-	Elements rules.Set // Configuration for elements (margins, fonts, etc.)
+	Template string     // Path to the LaTeX template file
+	Elements rules.Set  // Configuration for elements (margins, fonts, etc.)
+	Page     rules.Page // Paper size
 }
 
-// Inline markup patterns for LaTeX output
-var (
-	bolditalic = regexp.MustCompile(`\*{3}([^\*\n]+)\*{3}`)
-	bold       = regexp.MustCompile(`\*{2}([^\*\n]+)\*{2}`)
-	italic     = regexp.MustCompile(`\*{1}([^\*\n]+)\*{1}`)
-	underline  = regexp.MustCompile(`_{1}([^\*\n]+)_{1}`)
-)
+// latexCommands are the commands for the emphasis styles, outermost first
+var latexCommands = []struct {
+	style   lex.Style
+	command string
+}{
+	{lex.Bold, `\textbf{`},
+	{lex.Italic, `\textit{`},
+	{lex.Underline, `\underline{`},
+}
 
-// processInlineMarkup converts fountain-style inline markup to LaTeX using placeholders
+// processInlineMarkup converts fountain-style inline markup to LaTeX, escaping the text
 func processInlineMarkup(text string) string {
-	// Only process if the text contains markup characters
-	if !strings.ContainsAny(text, "*_") {
-		return text
-	}
-
-	// Use unique placeholders that won't conflict with LaTeX escaping
-	// Apply replacements in order: bold+italic first, then bold, then italic, then underline
-	// This prevents conflicts between overlapping patterns
-	text = bolditalic.ReplaceAllString(text, "XLATEXBOLDITALICSTARTX${1}XLATEXBOLDITALICENDX")
-	text = bold.ReplaceAllString(text, "XLATEXBOLDSTARTX${1}XLATEXBOLDENDX")
-	text = italic.ReplaceAllString(text, "XLATEXITALICSTARTX${1}XLATEXITALICENDX")
-	text = underline.ReplaceAllString(text, "XLATEXUNDERLINESTARTX${1}XLATEXUNDERLINEENDX")
-
-	return text
+	var b strings.Builder
+	writeSpans(&b, lex.ParseMarkup(text))
+	return b.String()
 }
 
-// replacePlaceholders converts placeholders back to LaTeX commands after escaping
-func replacePlaceholders(text string) string {
-	text = strings.ReplaceAll(text, "XLATEXBOLDITALICSTARTX", "\\textbf{\\textit{")
-	text = strings.ReplaceAll(text, "XLATEXBOLDITALICENDX", "}}")
-	text = strings.ReplaceAll(text, "XLATEXBOLDSTARTX", "\\textbf{")
-	text = strings.ReplaceAll(text, "XLATEXBOLDENDX", "}")
-	text = strings.ReplaceAll(text, "XLATEXITALICSTARTX", "\\textit{")
-	text = strings.ReplaceAll(text, "XLATEXITALICENDX", "}")
-	text = strings.ReplaceAll(text, "XLATEXUNDERLINESTARTX", "\\underline{")
-	text = strings.ReplaceAll(text, "XLATEXUNDERLINEENDX", "}")
-	return text
+// writeSpans writes a tree of inline markup spans as nested LaTeX commands
+func writeSpans(b *strings.Builder, spans []lex.Span) {
+	for _, span := range spans {
+		if span.Style == 0 {
+			b.WriteString(escapeLaTeX(span.Text))
+			continue
+		}
+		closing := ""
+		for _, c := range latexCommands {
+			if span.Style.Has(c.style) {
+				b.WriteString(c.command)
+				closing += "}"
+			}
+		}
+		writeSpans(b, span.Children)
+		b.WriteString(closing)
+	}
 }
 
 // LaTeXTemplateData combines configuration and screenplay data for the template
@@ -67,6 +65,8 @@ type LaTeXTemplateData struct {
 // LaTeXConfig holds the configuration values for the LaTeX template
 type LaTeXConfig struct {
 	// Page layout
+	PaperWidth   float64
+	PaperHeight  float64
 	LeftMargin   float64
 	RightMargin  float64
 	TopMargin    float64
@@ -104,7 +104,8 @@ const defaultLaTeXTemplate = `\documentclass[{{printf "%.0f" .Config.FontSize}}p
 \usepackage[utf8]{inputenc}
 \usepackage[T1]{fontenc}
 \usepackage{lmodern}
-\usepackage[letterpaper,
+\usepackage[paperwidth={{printf "%.2f" .Config.PaperWidth}}in,
+            paperheight={{printf "%.2f" .Config.PaperHeight}}in,
             left={{printf "%.1f" .Config.LeftMargin}}in,
             right={{printf "%.1f" .Config.RightMargin}}in,
             top={{printf "%.1f" .Config.TopMargin}}in,
@@ -112,6 +113,7 @@ const defaultLaTeXTemplate = `\documentclass[{{printf "%.0f" .Config.FontSize}}p
 \usepackage{setspace} % For line spacing
 \usepackage{fancyhdr} % For page headers
 \usepackage{array} % For dual dialogue tables
+\usepackage{xcolor} % For boneyard text
 
 % Set up courier font for screenplay formatting
 \usepackage{courier}
@@ -128,17 +130,21 @@ const defaultLaTeXTemplate = `\documentclass[{{printf "%.0f" .Config.FontSize}}p
 \newcommand{\sceneheading}[1]{\noindent\hspace{ {{- printf "%.1f" .Config.SceneLeft -}}in}` +
 	`\textbf{\MakeUppercase{#1}}\par\vspace{0.5\baselineskip}}
 \newcommand{\action}[1]{\noindent\hspace{ {{- printf "%.1f" .Config.ActionLeft -}}in}` +
-	`\parbox{ {{- printf "%.1f" (sub 8.5 .Config.LeftMargin .Config.RightMargin ` +
+	`\parbox{ {{- printf "%.1f" (sub .Config.PaperWidth .Config.LeftMargin .Config.RightMargin ` +
 	`.Config.ActionLeft .Config.ActionRight) -}}in}{#1}` +
 	`\par\vspace{\baselineskip}}
 \newcommand{\character}[1]{\noindent\hspace{ {{- printf "%.1f" .Config.SpeakerLeft -}}in}` +
 	`\textbf{\MakeUppercase{#1}}\par}
 \newcommand{\dialogue}[1]{\noindent\hspace{ {{- printf "%.1f" .Config.DialogLeft -}}in}` +
-	`\parbox{ {{- printf "%.1f" (sub 8.5 .Config.LeftMargin .Config.RightMargin ` +
+	`\parbox{ {{- printf "%.1f" (sub .Config.PaperWidth .Config.LeftMargin .Config.RightMargin ` +
 	`.Config.DialogLeft .Config.DialogRight) -}}in}{#1}\par}
 \newcommand{\parenthetical}[1]{\noindent\hspace{ {{- printf "%.1f" .Config.ParenLeft -}}in}\textit{#1}\par}
 \newcommand{\transition}[1]{\noindent\hfill\textbf{\MakeUppercase{#1}}\par\vspace{\baselineskip}}
 \newcommand{\centeredtext}[1]{\begin{center}#1\end{center}\par}
+\newcommand{\scriptnote}[1]{\noindent\hspace{ {{- printf "%.1f" .Config.ActionLeft -}}in}\textit{[#1]}\par}
+\newcommand{\boneyard}[1]{\noindent\hspace{ {{- printf "%.1f" .Config.ActionLeft -}}in}` +
+	`\parbox{ {{- printf "%.1f" (sub .Config.PaperWidth .Config.LeftMargin .Config.RightMargin ` +
+	`.Config.ActionLeft .Config.ActionRight) -}}in}{\color{gray}#1}\par\vspace{\baselineskip}}
 
 % Title page commands
 \newcommand{\titletext}[1]{\begin{center}\textbf{\large #1}\end{center}\vspace{\baselineskip}}
@@ -147,10 +153,10 @@ const defaultLaTeXTemplate = `\documentclass[{{printf "%.0f" .Config.FontSize}}p
 
 % Dual dialogue environment using tabular with configurable spacing
 \newenvironment{dualdialogue}{\noindent\begin{tabular}{` +
-	`p{ {{- printf "%.1f" (div (sub 8.5 .Config.LeftMargin .Config.RightMargin ` +
+	`p{ {{- printf "%.1f" (div (sub .Config.PaperWidth .Config.LeftMargin .Config.RightMargin ` +
 	`.Config.ActionLeft .Config.ActionRight) 2.2) -}}in}` +
 	`@{\hspace{0.3in}}` +
-	`p{ {{- printf "%.1f" (div (sub 8.5 .Config.LeftMargin .Config.RightMargin ` +
+	`p{ {{- printf "%.1f" (div (sub .Config.PaperWidth .Config.LeftMargin .Config.RightMargin ` +
 	`.Config.ActionLeft .Config.ActionRight) 2.2) -}}in}}}` +
 	`{\end{tabular}\par\vspace{\baselineskip}}
 \newcommand{\leftcol}{}
@@ -187,6 +193,10 @@ const defaultLaTeXTemplate = `\documentclass[{{printf "%.0f" .Config.FontSize}}p
         \transition{ {{- .Contents -}} }
     {{else if eq .Type "center"}}
         \centeredtext{ {{- .Contents -}} }
+    {{else if eq .Type "note"}}
+        \scriptnote{ {{- .Contents -}} }
+    {{else if eq .Type "boneyard"}}
+        \boneyard{ {{- .Contents -}} }
     {{else if eq .Type "newpage"}}
         \newpage
     {{else if eq .Type "empty"}}
@@ -213,11 +223,16 @@ const defaultLaTeXTemplate = `\documentclass[{{printf "%.0f" .Config.FontSize}}p
 `
 
 // getLatexConfig creates LaTeXConfig from rules configuration
-func (l *LaTeXWriter) getLatexConfig() LaTeXConfig {
+func (l *LaTeXWriter) getLatexConfig() (LaTeXConfig, error) {
 	elements := l.Elements
 	if elements == nil {
 		elements = rules.Default
 	}
+	width, height, err := l.Page.Dimensions()
+	if err != nil {
+		return LaTeXConfig{}, err
+	}
+	elements = elements.ForWidth(width)
 
 	// Get format configurations
 	action := elements.Get("action")
@@ -240,6 +255,8 @@ func (l *LaTeXWriter) getLatexConfig() LaTeXConfig {
 
 	return LaTeXConfig{
 		// Page layout - use standard margins
+		PaperWidth:   width,
+		PaperHeight:  height,
 		LeftMargin:   pageLeftMargin,
 		RightMargin:  pageRightMargin,
 		TopMargin:    1.0,
@@ -271,7 +288,7 @@ func (l *LaTeXWriter) getLatexConfig() LaTeXConfig {
 		DualSpeakerLeft: dualSpeaker.Left - pageLeftMargin,
 		DualDialogLeft:  dualDialog.Left - pageLeftMargin,
 		DualParenLeft:   dualParen.Left - pageLeftMargin,
-	}
+	}, nil
 }
 
 // preprocessDualDialogue converts speaker/dialog elements to dualspeaker/dualdialog
@@ -317,11 +334,23 @@ func preprocessDualDialogue(screenplay lex.Screenplay) lex.Screenplay {
 // (like `screenwright` or `fountain-latex`) installed on the system.
 // The PDF generation step is external to this Go program.
 func (l *LaTeXWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
+	// Leave out notes and boneyard unless the configuration shows them
+	elements := l.Elements
+	if elements == nil {
+		elements = rules.Default
+	}
+	screenplay = internal.Filter(screenplay, func(line lex.Line) bool {
+		return !line.IsAnnotation() || !elements.Get(line.Type).Hide
+	})
+
 	// Preprocess screenplay to handle dual dialogue
 	screenplay = preprocessDualDialogue(screenplay)
 
 	// Get template configuration from rules
-	config := l.getLatexConfig()
+	config, err := l.getLatexConfig()
+	if err != nil {
+		return err
+	}
 
 	// Create combined template data
 	data := LaTeXTemplateData{
@@ -331,7 +360,6 @@ func (l *LaTeXWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
 
 	// Attempt to parse the template from the provided path, or use the default
 	var tmpl *template.Template
-	var err error
 
 	// Create template with helper functions
 	funcMap := template.FuncMap{
@@ -359,20 +387,33 @@ func (l *LaTeXWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
 		}
 	}
 
-	// Process inline markup first with placeholders, then escape LaTeX, then replace placeholders
-	// This ensures that user content is escaped but markup commands are not
+	// Inline markup becomes LaTeX commands and the text in between is escaped
 	for i := range data.Screenplay {
-		// First process inline markup (converts to placeholders)
-		data.Screenplay[i].Contents = processInlineMarkup(data.Screenplay[i].Contents)
-		// Then escape LaTeX characters in user content
-		data.Screenplay[i].Contents = escapeLaTeX(data.Screenplay[i].Contents)
-		// Finally replace placeholders with actual LaTeX commands
-		data.Screenplay[i].Contents = replacePlaceholders(data.Screenplay[i].Contents)
+		// The extensions go after speaker names
+		data.Screenplay[i].Contents = processInlineMarkup(data.Screenplay[i].Text())
+		data.Screenplay[i].Extensions = nil
+		// Keep the line breaks and indentation of paragraphs and title page values
+		data.Screenplay[i].Contents = lineBreaks(data.Screenplay[i].Contents)
 	}
 
 	return tmpl.Execute(w, data)
 }
 
+// lineBreaks turns the rows of text spanning multiple lines into LaTeX line breaks.
+// Leading whitespace becomes unbreakable spaces and blank rows are kept with an empty box.
+func lineBreaks(s string) string {
+	rows := strings.Split(s, "\n")
+	for i, row := range rows {
+		content := strings.TrimLeft(row, " \t")
+		indent := strings.ReplaceAll(row[:len(row)-len(content)], "\t", "    ")
+		if content == "" && len(rows) > 1 {
+			content = `\mbox{}`
+		}
+		rows[i] = strings.Repeat("~", len(indent)) + content
+	}
+	return strings.Join(rows, `\\ `)
+}
+
 // escapeLaTeX escapes characters that have special meaning in LaTeX.
 // This is a basic implementation and might need to be extended for more complex scenarios.
 func escapeLaTeX(s string) string {
@@ -0,0 +1,24 @@
+package lex
+
+import "fmt"
+
+// ParseError is a problem found while parsing a screenplay, together with where it was found.
+type ParseError struct {
+	Pos Position
+	Err error
+}
+
+// Errorf returns a ParseError at the given position with a formatted message
+func Errorf(pos Position, format string, args ...any) *ParseError {
+	return &ParseError{Pos: pos, Err: fmt.Errorf(format, args...)}
+}
+
+// Error formats the error like a compiler diagnostic: file:line:col: message
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Pos, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -2,7 +2,9 @@ package lex
 
 import (
 	"bytes"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -33,7 +35,8 @@ func TestLexRoundTrip(t *testing.T) {
 	}
 
 	// 3. Parse the buffer content back into a new screenplay structure.
-	roundTripScreenplay := Parse(&buffer)
+	// Positions are stripped as the original screenplay has none.
+	roundTripScreenplay := mustParse(t, &buffer).WithoutPositions()
 
 	// 4. Compare the original and round-tripped screenplays.
 	if !reflect.DeepEqual(originalScreenplay, roundTripScreenplay) {
@@ -59,13 +62,13 @@ speaker: MARY
 dialog: Hello, world.
 `
 	reader := bytes.NewBufferString(lexData)
-	screenplay := Parse(reader)
+	screenplay := mustParse(t, reader)
 
 	expected := Screenplay{
-		Line{Type: "scene", Contents: "INT. HOUSE - DAY"},
-		Line{Type: "action", Contents: "An example action."},
-		Line{Type: "speaker", Contents: "MARY"},
-		Line{Type: "dialog", Contents: "Hello, world."},
+		Line{Type: "scene", Contents: "INT. HOUSE - DAY", Pos: Position{Line: 1, Col: 1, EndLine: 1, EndCol: 24}},
+		Line{Type: "action", Contents: "An example action.", Pos: Position{Line: 2, Col: 1, EndLine: 2, EndCol: 27}},
+		Line{Type: "speaker", Contents: "MARY", Pos: Position{Line: 3, Col: 1, EndLine: 3, EndCol: 14}},
+		Line{Type: "dialog", Contents: "Hello, world.", Pos: Position{Line: 4, Col: 1, EndLine: 4, EndCol: 22}},
 	}
 
 	if !reflect.DeepEqual(screenplay, expected) {
@@ -98,3 +101,330 @@ speaker: TOM
 		t.Logf("Expected:\n%s\n", expected)
 	}
 }
+
+// TestMultiLineContents checks that contents with newlines survive the lex format.
+func TestMultiLineContents(t *testing.T) {
+	original := Screenplay{
+		Line{Type: "boneyard", Contents: "Line one\nLine two with a \\ backslash"},
+		Line{Type: "action", Contents: "    Indented\n\tand tabbed"},
+	}
+
+	var buffer bytes.Buffer
+	writer := &LexWriter{}
+	if err := writer.Write(&buffer, original); err != nil {
+		t.Fatalf("Error writing screenplay: %v", err)
+	}
+	if got := buffer.String(); got != "boneyard: Line one\\nLine two with a \\\\ backslash\n"+
+		"action:     Indented\\n\tand tabbed\n" {
+		t.Errorf("Unexpected lex output: %q", got)
+	}
+
+	roundTrip := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(original, roundTrip) {
+		t.Errorf("Round-tripped contents do not match.\n  Got:      %#v\n  Expected: %#v", roundTrip, original)
+	}
+}
+
+// TestSplitSceneNumber checks that trailing scene numbers are separated from headings.
+func TestSplitSceneNumber(t *testing.T) {
+	tests := []struct {
+		heading  string
+		contents string
+		number   string
+	}{
+		{"INT. HOUSE - DAY #12A#", "INT. HOUSE - DAY", "12A"},
+		{"EXT. GARDEN #I-1-A#", "EXT. GARDEN", "I-1-A"},
+		{"INT. HOUSE - DAY", "INT. HOUSE - DAY", ""},
+		{"INT. ROOM #4 - NIGHT", "INT. ROOM #4 - NIGHT", ""},
+	}
+
+	for _, tt := range tests {
+		contents, number := SplitSceneNumber(tt.heading)
+		if contents != tt.contents || number != tt.number {
+			t.Errorf("SplitSceneNumber(%q) = (%q, %q), want (%q, %q)",
+				tt.heading, contents, number, tt.contents, tt.number)
+		}
+	}
+}
+
+// TestSplitExtensions checks that character extensions are separated from speaker names.
+func TestSplitExtensions(t *testing.T) {
+	tests := []struct {
+		speaker    string
+		name       string
+		extensions []string
+	}{
+		{"JOHN (V.O.)", "JOHN", []string{"V.O."}},
+		{"MARY (O.S.) (CONT'D)", "MARY", []string{"O.S.", "CONT'D"}},
+		{"MARY (cont'd)", "MARY", []string{"cont'd"}},
+		{"DR. SMITH", "DR. SMITH", nil},
+		{"(V.O.)", "(V.O.)", nil},
+	}
+
+	for _, tt := range tests {
+		name, extensions := SplitExtensions(tt.speaker)
+		if name != tt.name || !reflect.DeepEqual(extensions, tt.extensions) {
+			t.Errorf("SplitExtensions(%q) = (%q, %q), want (%q, %q)",
+				tt.speaker, name, extensions, tt.name, tt.extensions)
+		}
+		line := Line{Type: TypeSpeaker, Contents: name, Extensions: extensions}
+		if line.Text() != tt.speaker {
+			t.Errorf("Text() = %q, want %q", line.Text(), tt.speaker)
+		}
+	}
+
+	if !(Line{Extensions: []string{"cont’d"}}).HasExtension("CONT'D") {
+		t.Error("Expected cont’d to match CONT'D")
+	}
+}
+
+// TestNumberScenes checks automatic scene numbering around locked scene numbers.
+func TestNumberScenes(t *testing.T) {
+	screenplay := Screenplay{
+		Line{Type: TypeScene, Contents: "INT. ONE", SceneNumber: "1"},
+		Line{Type: TypeAction, Contents: "Some action."},
+		Line{Type: TypeScene, Contents: "INT. NEW"},
+		Line{Type: TypeScene, Contents: "INT. ALSO NEW"},
+		Line{Type: TypeScene, Contents: "INT. TWO", SceneNumber: "2"},
+		Line{Type: TypeScene, Contents: "INT. THREE"},
+		Line{Type: TypeScene, Contents: "INT. FOUR"},
+	}
+
+	numbered := screenplay.NumberScenes()
+
+	var got []string
+	for _, line := range numbered {
+		if line.Type == TypeScene {
+			got = append(got, line.SceneNumber)
+		}
+	}
+	expected := []string{"1", "1A", "1B", "2", "3", "4"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("NumberScenes() numbers = %v, want %v", got, expected)
+	}
+	if screenplay[2].SceneNumber != "" {
+		t.Errorf("NumberScenes() modified the original screenplay")
+	}
+}
+
+// TestNumberScenesBeforeFirst checks that scenes added before a locked first scene get a letter in front.
+func TestNumberScenesBeforeFirst(t *testing.T) {
+	tests := []struct {
+		locked   []string
+		expected []string
+	}{
+		{[]string{"", "", "1", ""}, []string{"A1", "B1", "1", "2"}},
+		{[]string{"A1", "", "1"}, []string{"A1", "B1", "1"}},
+		{[]string{"", "", "3"}, []string{"1", "2", "3"}},
+		{[]string{"", "1A"}, []string{"A1", "1A"}},
+	}
+	for _, test := range tests {
+		var screenplay Screenplay
+		for _, number := range test.locked {
+			screenplay = append(screenplay, Line{Type: TypeScene, Contents: "INT. HOUSE", SceneNumber: number})
+		}
+
+		var got []string
+		for _, line := range screenplay.NumberScenes() {
+			got = append(got, line.SceneNumber)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("NumberScenes() of %q = %v, want %v", test.locked, got, test.expected)
+		}
+	}
+}
+
+// TestSceneNumberRoundTrip checks that scene numbers survive the lex format.
+func TestSceneNumberRoundTrip(t *testing.T) {
+	original := Screenplay{
+		Line{Type: TypeScene, Contents: "INT. HOUSE - DAY", SceneNumber: "12A"},
+	}
+
+	var buffer bytes.Buffer
+	writer := &LexWriter{}
+	if err := writer.Write(&buffer, original); err != nil {
+		t.Fatalf("Error writing screenplay: %v", err)
+	}
+	if got := buffer.String(); got != "scene: INT. HOUSE - DAY #12A#\n" {
+		t.Errorf("Unexpected lex output: %q", got)
+	}
+
+	roundTrip := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(original, roundTrip) {
+		t.Errorf("Round-tripped scene number does not match.\n  Got:      %#v\n  Expected: %#v", roundTrip, original)
+	}
+}
+
+func TestNextNumber(t *testing.T) {
+	tests := map[string]string{"12": "13", "12A": "12B", "12Z": "12ZA"}
+	for number, expected := range tests {
+		if got := NextNumber(number); got != expected {
+			t.Errorf("NextNumber(%q) = %q, want %q", number, got, expected)
+		}
+	}
+}
+
+// mustParse parses a lex file and fails the test on errors
+func mustParse(t *testing.T, r io.Reader) Screenplay {
+	t.Helper()
+	screenplay, err := Parse(r)
+	if err != nil {
+		t.Fatalf("Parse returned an unexpected error: %v", err)
+	}
+	return screenplay
+}
+
+// TestParseErrors checks that contents without an element type are reported with their position.
+func TestParseErrors(t *testing.T) {
+	input := "action: Mary enters.\n: She sits down.\nspeaker: MARY\n"
+	screenplay, err := Parse(strings.NewReader(input))
+	if err == nil {
+		t.Fatal("Expected an error for contents without an element type")
+	}
+	if expected := "2:1: missing element type before the contents"; err.Error() != expected {
+		t.Errorf("Got error %q, expected %q", err.Error(), expected)
+	}
+	if len(screenplay) != 2 {
+		t.Errorf("Expected the valid lines to be parsed, got %#v", screenplay)
+	}
+}
+
+// TestRevisions checks that revision sets and revised elements survive the lex format.
+func TestRevisions(t *testing.T) {
+	screenplay := Screenplay{
+		Line{Type: TypeRevision, Contents: "Blue Revision", Revision: 1},
+		Line{Type: TypeRevision, Contents: "Pink Revision", Revision: 2},
+		Line{Type: TypeAction, Contents: "Mary enters."},
+		Line{Type: TypeAction, Contents: "Mary leaves.", Revision: 2},
+		Line{Type: "email@address", Contents: "not a revision"},
+	}
+
+	var buffer bytes.Buffer
+	if err := (&LexWriter{}).Write(&buffer, screenplay); err != nil {
+		t.Fatalf("Error writing screenplay: %v", err)
+	}
+	if !strings.Contains(buffer.String(), "action@2: Mary leaves.\n") {
+		t.Errorf("Expected the revision after the element type, got:\n%s", buffer.String())
+	}
+	roundTrip := mustParse(t, &buffer).WithoutPositions()
+	if !reflect.DeepEqual(roundTrip, screenplay) {
+		t.Errorf("Round-tripped revisions do not match.\n  Got:      %#v\n  Expected: %#v", roundTrip, screenplay)
+	}
+
+	if got := screenplay.LatestRevision(); got != "Pink Revision" {
+		t.Errorf("Expected Pink Revision as the latest revision, got %q", got)
+	}
+}
+
+// TestTitlePageNotes checks that a note between two title page keys doesn't end the title page.
+func TestTitlePageNotes(t *testing.T) {
+	screenplay := Screenplay{
+		Line{Type: TypeTitlePage},
+		Line{Type: KeyTitle, Contents: "Big Fish"},
+		Line{Type: TypeNote, Contents: "a note"},
+		Line{Type: KeyAuthor, Contents: "John"},
+		Line{Type: TypeNewPage},
+		Line{Type: TypeAction, Contents: "Edward enters."},
+	}
+	body, title := screenplay.SplitTitlePage()
+	if !reflect.DeepEqual(title, screenplay[:5]) || !reflect.DeepEqual(body, screenplay[5:]) {
+		t.Errorf("Expected the title page to end at the page break, got %#v", title)
+	}
+	if keys := screenplay.TitlePage(); !reflect.DeepEqual(keys, Screenplay{screenplay[1], screenplay[3]}) {
+		t.Errorf("Expected the title and author as title page keys, got %#v", keys)
+	}
+}
+
+// TestAutoContinued checks that automatic CONT'D extensions are added and removed
+// without touching the ones written by hand.
+func TestAutoContinued(t *testing.T) {
+	screenplay := Screenplay{
+		{Type: TypeScene, Contents: "INT. HOUSE - DAY"},
+		{Type: TypeSpeaker, Contents: "MARY"},
+		{Type: TypeDialog, Contents: "Hello."},
+		{Type: TypeAction, Contents: "She sits down."},
+		{Type: TypeSpeaker, Contents: "Mary", Extensions: []string{"V.O."}},
+		{Type: TypeDialog, Contents: "Still me."},
+		{Type: TypeSpeaker, Contents: "MARY", Extensions: []string{"cont'd"}},
+		{Type: TypeDialog, Contents: "And again."},
+		{Type: TypeSpeaker, Contents: "TOM"},
+		{Type: TypeDialog, Contents: "Hi."},
+		{Type: TypeScene, Contents: "EXT. GARDEN - DAY"},
+		{Type: TypeSpeaker, Contents: "TOM"},
+		{Type: TypeDialog, Contents: "Outside."},
+	}
+
+	got := screenplay.AutoContinued(true)
+	expected := []struct {
+		index      int
+		extensions []string
+	}{
+		{1, nil},
+		{4, []string{"V.O.", ContdExtension}},
+		{6, []string{"cont'd"}},
+		{8, nil},
+		{11, nil},
+	}
+	for _, e := range expected {
+		if !reflect.DeepEqual(got[e.index].Extensions, e.extensions) {
+			t.Errorf("Line %d has extensions %q, want %q", e.index, got[e.index].Extensions, e.extensions)
+		}
+	}
+	if !reflect.DeepEqual(got.AutoContinued(true), got) {
+		t.Error("Adding CONT'D twice should not change the screenplay")
+	}
+	if !reflect.DeepEqual(got.AutoContinued(false), screenplay) {
+		t.Errorf("Removing the automatic CONT'D should give the original, got %#v", got.AutoContinued(false))
+	}
+	if len(screenplay[4].Extensions) != 1 {
+		t.Errorf("AutoContinued should not change the original screenplay, got %q", screenplay[4].Extensions)
+	}
+}
+
+// TestParseMarkup checks the span trees of Fountain emphasis, including nesting and escapes.
+func TestParseMarkup(t *testing.T) {
+	text := func(s string) Span { return Span{Text: s} }
+	tests := []struct {
+		input    string
+		expected []Span
+	}{
+		{"plain", []Span{text("plain")}},
+		{"*italic* **bold** ***both***", []Span{
+			{Style: Italic, Children: []Span{text("italic")}}, text(" "),
+			{Style: Bold, Children: []Span{text("bold")}}, text(" "),
+			{Style: Bold | Italic, Children: []Span{text("both")}},
+		}},
+		{"_**word**_", []Span{
+			{Style: Underline, Children: []Span{{Style: Bold, Children: []Span{text("word")}}}},
+		}},
+		{"**bold *and italic***", []Span{
+			{Style: Bold, Children: []Span{text("bold "), {Style: Italic, Children: []Span{text("and italic")}}}},
+		}},
+		{"_under *and* line_", []Span{
+			{Style: Underline, Children: []Span{
+				text("under "), {Style: Italic, Children: []Span{text("and")}}, text(" line"),
+			}},
+		}},
+		{`\*not italic\* and a \\`, []Span{text(`*not italic* and a \`)}},
+		{"2 * 3 * 4", []Span{text("2 * 3 * 4")}},
+		{"*open\nclose*", []Span{text("*open\nclose*")}},
+		{"**unclosed *italic*", []Span{text("**unclosed "), {Style: Italic, Children: []Span{text("italic")}}}},
+	}
+	for _, tt := range tests {
+		if got := ParseMarkup(tt.input); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ParseMarkup(%q)\n  Got:      %#v\n  Expected: %#v", tt.input, got, tt.expected)
+		}
+	}
+
+	runs := MarkupRuns("a **b _c_** d")
+	expectedRuns := []Run{{"a ", 0}, {"b ", Bold}, {"c", Bold | Underline}, {" d", 0}}
+	if !reflect.DeepEqual(runs, expectedRuns) {
+		t.Errorf("MarkupRuns = %#v, expected %#v", runs, expectedRuns)
+	}
+	if got := PlainText(`**a** \_b\_`); got != "a _b_" {
+		t.Errorf("PlainText = %q, expected %q", got, "a _b_")
+	}
+	if got := PlainText(EscapeMarkup("*a_b*")); got != "*a_b*" {
+		t.Errorf("Escaped text should be printed as it is, got %q", got)
+	}
+}
@@ -0,0 +1,236 @@
+package lex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Inline markup follows the Fountain emphasis rules: *italic*, **bold**, ***bold italic***
+// and _underline_. Emphasis can be nested, like _**bold and underlined**_, but doesn't carry
+// over line breaks. A backslash escapes the markers, so \* is a literal asterisk.
+// Markers that don't open or close emphasis are kept as text: an opening marker has to
+// be followed by text and a closing marker preceded by it, so 2 * 3 * 4 stays as it is.
+
+// Style is a combination of emphasis styles
+type Style uint8
+
+// The emphasis styles of inline markup
+const (
+	Bold Style = 1 << iota
+	Italic
+	Underline
+)
+
+// Has returns true if the style includes all of the given styles
+func (s Style) Has(style Style) bool {
+	return s&style == style
+}
+
+// Span is a part of a text with inline markup. A span either holds plain text,
+// or emphasis that applies to its children.
+type Span struct {
+	Style    Style  // Emphasis added by this span, 0 for plain text
+	Text     string // Text of a plain span
+	Children []Span // Spans inside the emphasis
+}
+
+// Run is a piece of text with the emphasis that applies to it
+type Run struct {
+	Text  string
+	Style Style
+}
+
+// markupItem is a span or a run of emphasis markers while parsing inline markup
+type markupItem struct {
+	span   Span
+	marker rune // '*' or '_' for a run of markers, 0 for a span
+	count  int  // Number of markers left in the run
+	open   bool // The run can open emphasis
+}
+
+// ParseMarkup parses the inline markup of a text into a tree of spans
+func ParseMarkup(text string) []Span {
+	var spans []Span
+	for i, row := range strings.Split(text, "\n") {
+		if i > 0 {
+			spans = appendText(spans, "\n")
+		}
+		for _, span := range parseMarkupRow(row) {
+			if span.Style == 0 {
+				spans = appendText(spans, span.Text)
+			} else {
+				spans = append(spans, span)
+			}
+		}
+	}
+	return spans
+}
+
+// parseMarkupRow parses the inline markup of a single row
+func parseMarkupRow(row string) []Span {
+	var items []*markupItem
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			items = append(items, &markupItem{span: Span{Text: text.String()}})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(row); {
+		c := row[i]
+		switch {
+		case c == '\\' && i+1 < len(row) && strings.IndexByte(`\*_`, row[i+1]) >= 0:
+			text.WriteByte(row[i+1])
+			i += 2
+		case c == '*' || c == '_':
+			end := i
+			for end < len(row) && row[end] == c {
+				end++
+			}
+			flush()
+			items = addMarkers(items, rune(c), end-i, canOpen(row, end), canClose(row, i))
+			i = end
+		default:
+			text.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+
+	var spans []Span
+	for _, item := range items {
+		spans = appendItem(spans, item)
+	}
+	return spans
+}
+
+// canOpen returns true if markers ending at end are followed by text
+func canOpen(row string, end int) bool {
+	r, _ := utf8.DecodeRuneInString(row[end:])
+	return end < len(row) && !unicode.IsSpace(r)
+}
+
+// canClose returns true if markers starting at start are preceded by text
+func canClose(row string, start int) bool {
+	r, _ := utf8.DecodeLastRuneInString(row[:start])
+	return start > 0 && !unicode.IsSpace(r)
+}
+
+// addMarkers closes as much emphasis as possible with a run of markers and adds what is left
+// of the run, which may open emphasis later on.
+func addMarkers(items []*markupItem, marker rune, count int, open, close bool) []*markupItem {
+	for close && count > 0 {
+		k := len(items) - 1
+		for k >= 0 && (items[k].marker != marker || !items[k].open || items[k].count == 0) {
+			k--
+		}
+		if k < 0 {
+			break
+		}
+		opener := items[k]
+		used, style := emphasis(marker, opener.count, count)
+		opener.count -= used
+		count -= used
+
+		var children []Span
+		for _, item := range items[k+1:] {
+			children = appendItem(children, item)
+		}
+		span := &markupItem{span: Span{Style: style, Children: children}}
+		if opener.count == 0 {
+			items = append(items[:k], span)
+		} else {
+			items = append(items[:k+1], span)
+		}
+	}
+	if count > 0 {
+		items = append(items, &markupItem{marker: marker, count: count, open: open})
+	}
+	return items
+}
+
+// emphasis returns how many markers of an opening and a closing run are used together and the style they give.
+// Runs of three asterisks on both sides are bold italic, otherwise two make bold and one italic.
+func emphasis(marker rune, opening, closing int) (int, Style) {
+	switch {
+	case marker == '_':
+		return 1, Underline
+	case opening >= 3 && closing >= 3:
+		return 3, Bold | Italic
+	case opening >= 2 && closing >= 2:
+		return 2, Bold
+	default:
+		return 1, Italic
+	}
+}
+
+// appendItem adds a parsed item to spans. Markers that weren't used become plain text.
+func appendItem(spans []Span, item *markupItem) []Span {
+	if item.marker != 0 {
+		return appendText(spans, strings.Repeat(string(item.marker), item.count))
+	}
+	if item.span.Style == 0 {
+		return appendText(spans, item.span.Text)
+	}
+	return append(spans, item.span)
+}
+
+// appendText adds plain text to spans, joining it with plain text right before it
+func appendText(spans []Span, text string) []Span {
+	if text == "" {
+		return spans
+	}
+	if n := len(spans); n > 0 && spans[n-1].Style == 0 && spans[n-1].Children == nil {
+		spans[n-1].Text += text
+		return spans
+	}
+	return append(spans, Span{Text: text})
+}
+
+// MarkupRuns parses the inline markup of a text into runs of text with the same emphasis
+func MarkupRuns(text string) []Run {
+	var runs []Run
+	var walk func(spans []Span, style Style)
+	walk = func(spans []Span, style Style) {
+		for _, span := range spans {
+			if span.Style == 0 && span.Children == nil {
+				runs = appendRun(runs, Run{Text: span.Text, Style: style})
+				continue
+			}
+			walk(span.Children, style|span.Style)
+		}
+	}
+	walk(ParseMarkup(text), 0)
+	return runs
+}
+
+// appendRun adds a run, joining it with the run before it if that has the same emphasis
+func appendRun(runs []Run, run Run) []Run {
+	if n := len(runs); n > 0 && runs[n-1].Style == run.Style {
+		runs[n-1].Text += run.Text
+		return runs
+	}
+	return append(runs, run)
+}
+
+// PlainText returns a text with inline markup as it is printed, without markers and escapes
+func PlainText(text string) string {
+	if !strings.ContainsAny(text, `*_\`) {
+		return text
+	}
+	var b strings.Builder
+	for _, run := range MarkupRuns(text) {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// markupEscaper escapes the characters that would otherwise be read as inline markup
+var markupEscaper = strings.NewReplacer(`*`, `\*`, `_`, `\_`)
+
+// EscapeMarkup escapes the emphasis markers in plain text, so they are printed as they are
+func EscapeMarkup(text string) string {
+	return markupEscaper.Replace(text)
+}
@@ -2,32 +2,75 @@ package lex
 
 import (
 	"bufio"
+	"errors"
 	"io"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Parse walks through the lex file, which contains the element of a screenplay,
 // optionally followed by a colon and space and the actual contents of that element.
-// Special elements exist: newpage, titlepage and metasection.
+// Special elements exist: newpage, titlepage, metasection and revision.
 // These elements trigger pdf creation instructions.
-func Parse(file io.Reader) (out Screenplay) {
+// Speakers are split into the name and their character extensions.
+// Elements changed in a revision have the ID of the revision set after an @, e.g. action@2.
+// Every line records its position in the lex file.
+// Malformed lines are reported as ParseErrors, together with everything that could be parsed.
+func Parse(file io.Reader) (Screenplay, error) {
+	var out Screenplay
+	var errs []error
 	f := bufio.NewReader(file)
+	name := SourceName(file)
 	var err error
 	var s string
-	for err == nil {
+	for lineNum := 1; err == nil; lineNum++ {
 		var line Line
 		s, err = f.ReadString('\n')
+		if err != nil && err != io.EOF {
+			errs = append(errs, &ParseError{Pos: Position{File: name, Line: lineNum}, Err: err})
+		}
+		line.Pos = RowPosition(name, lineNum, s)
+		if !utf8.ValidString(s) {
+			errs = append(errs, Errorf(line.Pos, "invalid UTF-8 text"))
+			continue
+		}
 		split := strings.SplitN(s, ":", 2)
 		switch len(split) {
 		case 0, 1:
-			line.Type = strings.Trim(s, ": \n\r")
+			line.Type, line.Revision = splitRevision(strings.Trim(s, ": \n\r"))
 		case 2:
-			line.Type = split[0]
-			line.Contents = strings.TrimSpace(split[1])
+			line.Type, line.Revision = splitRevision(split[0])
+			// Only the space after the colon is left out, so indentation of the contents is kept
+			contents := strings.TrimPrefix(strings.TrimRightFunc(split[1], unicode.IsSpace), " ")
+			line.Contents = contentUnescaper.Replace(contents)
+			if line.Type == TypeScene {
+				line.Contents, line.SceneNumber = SplitSceneNumber(line.Contents)
+			}
+			if line.Type == TypeSpeaker {
+				line.Contents, line.Extensions = SplitExtensions(line.Contents)
+			}
 		}
 		if strings.TrimSpace(split[0]) != "" {
 			out = append(out, line)
+		} else if len(split) == 2 && strings.TrimSpace(split[1]) != "" {
+			errs = append(errs, Errorf(line.Pos, "missing element type before the contents"))
 		}
 	}
-	return out
+	return out, errors.Join(errs...)
+}
+
+// splitRevision separates the revision set ID from an element type like action@2.
+// Types without a valid ID are returned as they are, with revision 0.
+func splitRevision(element string) (string, int) {
+	i := strings.LastIndex(element, "@")
+	if i < 0 {
+		return element, 0
+	}
+	revision, err := strconv.Atoi(element[i+1:])
+	if err != nil || revision <= 0 {
+		return element, 0
+	}
+	return element[:i], revision
 }
@@ -0,0 +1,119 @@
+package lex
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sceneNumber matches a Fountain scene number like #12A# at the end of a scene heading.
+var sceneNumber = regexp.MustCompile(`\s*#([0-9A-Za-z.\-]+)#\s*$`)
+
+// SplitSceneNumber separates a trailing scene number from a scene heading.
+// "INT. HOUSE - DAY #12A#" becomes "INT. HOUSE - DAY" and "12A".
+// The number is empty if the heading doesn't have one.
+func SplitSceneNumber(heading string) (string, string) {
+	match := sceneNumber.FindStringSubmatchIndex(heading)
+	if match == nil {
+		return heading, ""
+	}
+	return heading[:match[0]], heading[match[2]:match[3]]
+}
+
+// NumberScenes returns a copy of the screenplay in which every scene heading has a number.
+// Existing numbers are locked and kept as they are. Scenes without a number continue
+// counting from the previous scene. When the next number is already taken by a locked
+// scene further on, a letter suffix is used instead, so a scene added after 4 becomes 4A.
+// Scenes added before a locked 1 get a letter in front: A1, B1 and so on.
+func (s Screenplay) NumberScenes() Screenplay {
+	out := make(Screenplay, len(s))
+	copy(out, s)
+
+	used := make(map[string]bool)
+	for _, line := range out {
+		if line.Type == TypeScene && line.SceneNumber != "" {
+			used[strings.ToUpper(line.SceneNumber)] = true
+		}
+	}
+
+	prev := "0"
+	for i, line := range out {
+		if line.Type != TypeScene {
+			continue
+		}
+		if line.SceneNumber == "" {
+			out[i].SceneNumber = nextSceneNumber(prev, nextLockedNumber(out[i+1:]), used)
+			used[out[i].SceneNumber] = true
+		}
+		prev = out[i].SceneNumber
+	}
+	return out
+}
+
+// nextLockedNumber returns the numeric part of the next numbered scene, or -1 if there is none.
+func nextLockedNumber(rest Screenplay) int {
+	for _, line := range rest {
+		if line.Type == TypeScene && line.SceneNumber != "" {
+			n, _ := splitNumber(line.SceneNumber)
+			return n
+		}
+	}
+	return -1
+}
+
+// nextSceneNumber picks the number for a scene following prev.
+func nextSceneNumber(prev string, nextLocked int, used map[string]bool) string {
+	n, suffix := splitNumber(prev)
+	if n == 0 && nextLocked >= 0 && nextLocked <= 1 {
+		return prefixedSceneNumber(max(nextLocked, 1), used)
+	}
+	candidate := strconv.Itoa(n + 1)
+	if nextLocked >= 0 && n+1 >= nextLocked || used[candidate] {
+		candidate = strconv.Itoa(n) + nextSuffix(suffix)
+	}
+	for used[candidate] {
+		_, suffix = splitNumber(candidate)
+		candidate = strconv.Itoa(n) + nextSuffix(suffix)
+	}
+	return candidate
+}
+
+// prefixedSceneNumber picks the number for a scene before the first locked scene when there is no
+// number left before it. A letter is put in front instead, so scenes added before 1 become A1, B1 and so on.
+func prefixedSceneNumber(next int, used map[string]bool) string {
+	prefix := "A"
+	for used[prefix+strconv.Itoa(next)] {
+		prefix = nextSuffix(prefix)
+	}
+	return prefix + strconv.Itoa(next)
+}
+
+// NextNumber returns the scene or page number that follows the given one.
+// Plain numbers count up, numbers with a letter suffix get the next suffix: 12 → 13, 12A → 12B.
+func NextNumber(number string) string {
+	n, suffix := splitNumber(number)
+	if suffix == "" {
+		return strconv.Itoa(n + 1)
+	}
+	return strconv.Itoa(n) + nextSuffix(suffix)
+}
+
+// splitNumber splits a scene number like "12A" into its leading number and the rest.
+// Numbers without leading digits count as 0.
+func splitNumber(number string) (int, string) {
+	digits := len(number) - len(strings.TrimLeft(number, "0123456789"))
+	n, _ := strconv.Atoi(number[:digits])
+	return n, strings.ToUpper(number[digits:])
+}
+
+// nextSuffix returns the letter suffix that follows the given one: "" → A, A → B, Z → ZA.
+func nextSuffix(suffix string) string {
+	if suffix == "" {
+		return "A"
+	}
+	last := suffix[len(suffix)-1]
+	if last >= 'A' && last < 'Z' {
+		return suffix[:len(suffix)-1] + string(last+1)
+	}
+	return suffix + "A"
+}
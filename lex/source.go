@@ -0,0 +1,30 @@
+package lex
+
+import "reflect"
+
+// In preserve mode a parser keeps the source text of every element, so a writer for the same
+// format can write the elements that weren't changed back byte for byte. Rows that no element
+// was read from, like extra blank rows, are kept with the element after them. Elements sharing
+// a row with the element before them, like inline notes, have an empty source text.
+
+// Source is the text an element was read from in preserve mode
+type Source struct {
+	Text string // The source rows of the element, including the rows before it that no other element has
+	Line Line   // The element as it was read, without its position
+}
+
+// NewSource returns the source of a line read from text
+func NewSource(line Line, text string) *Source {
+	line.Pos, line.Source = Position{}, nil
+	return &Source{Text: text, Line: line}
+}
+
+// Unchanged returns true if the line has a source and is still the element that was read from it
+func (l Line) Unchanged() bool {
+	if l.Source == nil {
+		return false
+	}
+	original := l.Source.Line
+	l.Pos, l.Source = Position{}, nil
+	return reflect.DeepEqual(l, original)
+}
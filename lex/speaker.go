@@ -0,0 +1,112 @@
+package lex
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ContdExtension is the extension of a character who continues speaking after an interruption
+const ContdExtension = "CONT'D"
+
+// extension matches a character extension like (V.O.) at the end of a speaker line.
+var extension = regexp.MustCompile(`\s*\(([^()]*)\)\s*$`)
+
+// SplitExtensions separates the character extensions from a speaker line.
+// "MARY (V.O.) (CONT'D)" becomes "MARY" and ["V.O.", "CONT'D"].
+// The extensions are nil if the line doesn't have any, or if nothing but extensions is left.
+func SplitExtensions(speaker string) (string, []string) {
+	name := speaker
+	var extensions []string
+	for {
+		match := extension.FindStringSubmatchIndex(name)
+		if match == nil {
+			break
+		}
+		extensions = append([]string{strings.TrimSpace(name[match[2]:match[3]])}, extensions...)
+		name = name[:match[0]]
+	}
+	if strings.TrimSpace(name) == "" {
+		return speaker, nil
+	}
+	return name, extensions
+}
+
+// Text returns the contents of the line the way they are printed.
+// Speakers get their extensions after the name, e.g. "MARY (V.O.)".
+func (l Line) Text() string {
+	if len(l.Extensions) == 0 {
+		return l.Contents
+	}
+	return l.Contents + " (" + strings.Join(l.Extensions, ") (") + ")"
+}
+
+// HasExtension returns true if the speaker has the given extension.
+// Case and the style of apostrophe don't matter, so CONT'D matches cont’d.
+func (l Line) HasExtension(ext string) bool {
+	for _, e := range l.Extensions {
+		if normalizeExtension(e) == normalizeExtension(ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeExtension returns the extension in upper case with straight apostrophes
+func normalizeExtension(ext string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(ext), "’", "'"))
+}
+
+// AutoContinued returns a copy of the screenplay in which speakers who speak again, with only
+// action since their previous speech in the same scene, get an automatic CONT'D extension.
+// Automatic extensions that no longer apply are removed, and all of them if on is false.
+// Extensions written by hand are left as they are. Speeches in dual dialogue are never continued.
+// No format stores the Continued mark, so this isn't meant for Fountain or lex output: a file
+// written from the result would read the extension back as written by hand.
+func (s Screenplay) AutoContinued(on bool) Screenplay {
+	out := make(Screenplay, len(s))
+	copy(out, s)
+
+	previous := "" // Name of the last speaker, empty if the next speech can't continue it
+	dual := false
+	for i, line := range out {
+		switch line.Type {
+		case TypeSpeaker:
+			line = line.withoutAutoContd()
+			name := strings.ToUpper(strings.TrimSpace(line.Contents))
+			if on && !dual && name == previous && !line.HasExtension(ContdExtension) {
+				line.Extensions = append(slices.Clone(line.Extensions), ContdExtension)
+				line.Continued = true
+			}
+			out[i] = line
+			previous = name
+		case TypeDialog, TypeParen, TypeLyrics, TypeAction, TypeEmpty, TypeNote, TypeBoneyard,
+			TypeNewPage, TypeRevision:
+			// These don't interrupt a character
+		case TypeDualOpen, TypeDualClose:
+			dual = line.Type == TypeDualOpen
+			previous = ""
+		default:
+			previous = ""
+		}
+		if dual {
+			previous = ""
+		}
+	}
+	return out
+}
+
+// withoutAutoContd returns the speaker without its automatic CONT'D extension
+func (l Line) withoutAutoContd() Line {
+	if !l.Continued {
+		return l
+	}
+	l.Continued = false
+	if i := slices.IndexFunc(l.Extensions, func(e string) bool { return e == ContdExtension }); i >= 0 {
+		l.Extensions = slices.Delete(slices.Clone(l.Extensions), i, i+1)
+	}
+	if len(l.Extensions) == 0 {
+		l.Extensions = nil
+	}
+	return l
+}
@@ -0,0 +1,108 @@
+package lex
+
+import "strings"
+
+// The title page is a block of lines at the start of a screenplay, opened by a titlepage line
+// and closed by a newpage line. Every key of the title page is a line with the key as its type
+// and the value as its contents, values spanning multiple lines are joined with newlines.
+// A metasection line separates the title, credit and author from the other keys.
+
+// Title page keys with a place of their own in the standard layout
+const (
+	KeyTitle     = "Title"
+	KeyCredit    = "Credit"
+	KeyAuthor    = "Author"
+	KeySource    = "Source"
+	KeyDraftDate = "Draft date"
+	KeyContact   = "Contact"
+	KeyNotes     = "Notes"
+	KeyCopyright = "Copyright"
+)
+
+// TypeMetaSection separates the title, credit and author from the other title page keys
+const TypeMetaSection ElementType = "metasection"
+
+// TitleBlock is a part of the standard title page layout
+type TitleBlock int
+
+// The blocks of the standard title page layout
+const (
+	TitleCenter TitleBlock = iota // The title, credit, author and source in the middle of the page
+	TitleLeft                     // Contact details, notes and other keys at the bottom left
+	TitleRight                    // The draft date at the bottom right
+)
+
+// TitlePlacement returns the block of the standard title page layout a key is printed in.
+// Keys are matched without regard to case.
+func TitlePlacement(key string) TitleBlock {
+	switch strings.ToLower(key) {
+	case "title", "credit", "author", "authors", "source":
+		return TitleCenter
+	case "draft date", "date":
+		return TitleRight
+	default:
+		return TitleLeft
+	}
+}
+
+// isStandardTitleKey returns true for keys that are printed without their name
+func isStandardTitleKey(key string) bool {
+	switch strings.ToLower(key) {
+	case "title", "credit", "author", "authors", "source", "draft date", "date", "contact", "notes", "copyright":
+		return true
+	default:
+		return false
+	}
+}
+
+// TitleText returns the text of a title page line as it is printed. Other keys than the
+// standard ones are printed with their name, e.g. "Revision: Blue".
+func (l Line) TitleText() string {
+	if isStandardTitleKey(l.Type) {
+		return l.Contents
+	}
+	return l.Type + ": " + l.Contents
+}
+
+// SplitTitlePage separates the title page at the start of the screenplay, including the
+// page break that ends it, from the rest. Without a page break the title page ends at the
+// first screenplay element. Notes and boneyard written between the keys belong to the title page.
+// The title page is empty if the screenplay has none.
+func (s Screenplay) SplitTitlePage() (Screenplay, Screenplay) {
+	if len(s) == 0 || s[0].Type != TypeTitlePage {
+		return s, nil
+	}
+	for i, line := range s {
+		switch {
+		case line.Type == TypeNewPage:
+			return s[i+1:], s[:i+1]
+		case i > 0 && isBodyType(line.Type):
+			return s[i:], s[:i]
+		}
+	}
+	return nil, s
+}
+
+// isBodyType returns true for the element types of the screenplay itself, which can't be title page keys
+func isBodyType(t ElementType) bool {
+	switch t {
+	case TypeScene, TypeAction, TypeSpeaker, TypeDialog, TypeParen, TypeTrans, TypeEmpty, TypeCenter, TypeLyrics,
+		TypeDualOpen, TypeDualNext, TypeDualClose, "section", "synopse":
+		return true
+	default:
+		return false
+	}
+}
+
+// TitlePage returns the keys of the title page, leaving out the lines that only mark its structure
+// and the notes and boneyard between the keys.
+func (s Screenplay) TitlePage() Screenplay {
+	_, title := s.SplitTitlePage()
+	var keys Screenplay
+	for _, line := range title {
+		if line.Type != TypeTitlePage && line.Type != TypeMetaSection && line.Type != TypeNewPage && !line.IsAnnotation() {
+			keys = append(keys, line)
+		}
+	}
+	return keys
+}
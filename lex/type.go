@@ -1,6 +1,12 @@
 // The lex format is basically a parse tree for screenplays, which enables quick debugging.
 package lex
 
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
 // Type aliases for better readability
 type (
 	ElementType = string
@@ -24,13 +30,97 @@ const (
 	TypeNewPage   ElementType = "newpage"
 	TypeCenter    ElementType = "center"
 	TypeLyrics    ElementType = "lyrics"
+	TypeNote      ElementType = "note"
+	TypeBoneyard  ElementType = "boneyard"
+	TypeRevision  ElementType = "revision" // Declares a revision set, Contents is its name, e.g. "Blue Revision"
 )
 
 type Screenplay []Line
 
 type Line struct {
-	Type     ElementType
-	Contents Content
+	Type        ElementType
+	Contents    Content
+	SceneNumber string   // Number of a scene heading, e.g. "12A", empty if unnumbered
+	Extensions  []string // Character extensions of a speaker without parentheses, e.g. "V.O." or "CONT'D"
+	Continued   bool     // The speaker got an automatic CONT'D extension from AutoContinued
+	Revision    int      // ID of the revision set the element was last changed in, 0 if it is unrevised
+	Color       string   // Color of a revision set as read from FDX, e.g. "#8080FF", empty if unknown
+	Mark        string   // Mark of a revision set printed next to its changes as read from FDX, empty if unknown
+	Inline      bool     // A note or boneyard written inside the text of the element before it, at Offset
+	Offset      int      // Byte offset of an inline note or boneyard in the Text of the element before it
+	Pos         Position // Where the element was found in the source, zero if unknown
+	Source      *Source  // The source text the element was read from, only kept by parsers in preserve mode
+}
+
+// Position describes the source span of an element.
+// Lines and columns are 1-based and columns count bytes, like go/token.
+// EndLine and EndCol point just past the last character of the element.
+type Position struct {
+	File    string
+	Line    int
+	Col     int
+	EndLine int
+	EndCol  int
+}
+
+// IsValid returns true if the position refers to an actual source location
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String formats the position as file:line:col, leaving out unknown parts
+func (p Position) String() string {
+	s := p.File
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += strconv.Itoa(p.Line)
+		if p.Col > 0 {
+			s += ":" + strconv.Itoa(p.Col)
+		}
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// WithoutPositions returns a copy of the screenplay with all source positions cleared.
+// This makes it possible to compare screenplays that were read from different sources.
+func (s Screenplay) WithoutPositions() Screenplay {
+	if s == nil {
+		return nil
+	}
+	out := make(Screenplay, len(s))
+	for i, line := range s {
+		line.Pos = Position{}
+		out[i] = line
+	}
+	return out
+}
+
+// SourceName returns the name of the file behind a reader if it has one, e.g. an *os.File.
+// It returns an empty string otherwise.
+func SourceName(r io.Reader) string {
+	if named, ok := r.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return ""
+}
+
+// RowPosition returns the position of a single source row, spanning from its
+// first to its last non-whitespace character.
+func RowPosition(file string, line int, row string) Position {
+	row = strings.TrimRight(row, " \t\r\n")
+	col := len(row) - len(strings.TrimLeft(row, " \t")) + 1
+	return Position{
+		File:    file,
+		Line:    line,
+		Col:     col,
+		EndLine: line,
+		EndCol:  len(row) + 1,
+	}
 }
 
 // IsDialogueElement returns true if the line is part of dialogue
@@ -43,6 +133,26 @@ func (l Line) IsDualDialogueMarker() bool {
 	return l.Type == TypeDualOpen || l.Type == TypeDualNext || l.Type == TypeDualClose
 }
 
+// IsAnnotation returns true if the line is a note or boneyard block,
+// which writers may hide or render depending on their configuration
+func (l Line) IsAnnotation() bool {
+	return l.Type == TypeNote || l.Type == TypeBoneyard
+}
+
+// LatestRevision returns the name of the revision set with the highest ID,
+// or an empty string if the screenplay has no revisions.
+func (s Screenplay) LatestRevision() string {
+	var name string
+	latest := 0
+	for _, line := range s {
+		if line.Type == TypeRevision && line.Revision > latest {
+			latest = line.Revision
+			name = line.Contents
+		}
+	}
+	return name
+}
+
 // IsEmpty returns true if the line has no content or is an empty type
 func (l Line) IsEmpty() bool {
 	return l.Type == TypeEmpty || l.Contents == ""
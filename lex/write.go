@@ -3,6 +3,15 @@ package lex
 import (
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+)
+
+// Contents spanning multiple lines, such as notes and boneyard blocks,
+// are kept on a single lex line by escaping newlines and backslashes.
+var (
+	contentEscaper   = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	contentUnescaper = strings.NewReplacer("\\\\", "\\", "\\n", "\n")
 )
 
 // LexWriter implements the writer.Writer interface for LEX output.
@@ -12,7 +21,15 @@ type LexWriter struct{}
 // It implements the writer.Writer interface.
 func (l *LexWriter) Write(w io.Writer, screenplay Screenplay) error {
 	for _, line := range screenplay {
-		_, err := fmt.Fprintf(w, "%s: %s\n", line.Type, line.Contents)
+		contents := contentEscaper.Replace(line.Text())
+		if line.SceneNumber != "" {
+			contents += " #" + line.SceneNumber + "#"
+		}
+		element := line.Type
+		if line.Revision > 0 {
+			element += "@" + strconv.Itoa(line.Revision)
+		}
+		_, err := fmt.Fprintf(w, "%s: %s\n", element, contents)
 		if err != nil {
 			return err
 		}
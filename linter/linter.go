@@ -10,9 +10,10 @@ import (
 
 // LintError represents a single linting issue found in the screenplay.
 type LintError struct {
-	LineNum int    // The 1-based line number where the error occurred
-	Message string // A descriptive message about the error
-	Context string // The line content or relevant context
+	LineNum int          // The 1-based line number where the error occurred
+	Pos     lex.Position // The full source position, if the parser recorded one
+	Message string       // A descriptive message about the error
+	Context string       // The line content or relevant context
 }
 
 // Linter provides methods to lint a lex.Screenplay.
@@ -26,70 +27,87 @@ func NewLinter() *Linter {
 }
 
 // Lint performs linting checks on the given screenplay and stores any found errors.
-// This function maps lex.Screenplay back to conceptual lines for easier error reporting.
+// Errors are reported at the source position the parser recorded for each line.
+// Screenplays without positions fall back to counting elements.
 func (l *Linter) Lint(screenplay lex.Screenplay) {
-	currentLineNum := 1 // Start at line 1
+	currentPos := lex.Position{Line: 1} // Start at line 1
 	inDualDialogueBlock := false
 
 	for i, line := range screenplay {
-		currentLineNum = l.updateLineNumber(line, currentLineNum)
-		inDualDialogueBlock = l.checkDualDialogueIssues(line, currentLineNum, inDualDialogueBlock)
-		l.checkBasicIssues(line, screenplay, i, currentLineNum)
+		currentPos = l.updatePosition(line, currentPos)
+		inDualDialogueBlock = l.checkDualDialogueIssues(line, currentPos, inDualDialogueBlock)
+		l.checkBasicIssues(line, screenplay, i, currentPos)
 	}
 }
 
-// updateLineNumber increments line number for content lines
-func (l *Linter) updateLineNumber(line lex.Line, currentLineNum int) int {
+// updatePosition returns the source position of a line, or an estimate if it has none
+func (l *Linter) updatePosition(line lex.Line, currentPos lex.Position) lex.Position {
+	if line.Pos.IsValid() {
+		return line.Pos
+	}
 	// These are structural and don't directly correspond to input lines
 	if line.Type != lex.TypeTitlePage && line.Type != "metasection" {
-		return currentLineNum + 1
+		return lex.Position{File: currentPos.File, Line: currentPos.Line + 1}
 	}
-	return currentLineNum
+	return currentPos
 }
 
 // checkDualDialogueIssues handles dual dialogue validation
-func (l *Linter) checkDualDialogueIssues(line lex.Line, currentLineNum int, inDualDialogueBlock bool) bool {
+func (l *Linter) checkDualDialogueIssues(line lex.Line, pos lex.Position, inDualDialogueBlock bool) bool {
 	switch line.Type {
 	case lex.TypeDualOpen:
 		if inDualDialogueBlock {
-			l.addError(currentLineNum, internal.MsgNestedDualDialogue, line.Contents)
+			l.addError(pos, internal.MsgNestedDualDialogue, line.Contents)
 		}
 		return true
 	case lex.TypeDualClose:
 		return false
 	case lex.TypeSpeaker:
 		if strings.HasSuffix(strings.TrimSpace(line.Contents), "^") && inDualDialogueBlock {
-			l.addError(currentLineNum, internal.MsgTooManyDualSpeakers, line.Contents)
+			l.addError(pos, internal.MsgTooManyDualSpeakers, line.Contents)
 		}
 	}
 	return inDualDialogueBlock
 }
 
 // checkBasicIssues performs basic validation checks
-func (l *Linter) checkBasicIssues(line lex.Line, screenplay lex.Screenplay, i, currentLineNum int) {
+func (l *Linter) checkBasicIssues(line lex.Line, screenplay lex.Screenplay, i int, pos lex.Position) {
 	// Check for empty speaker names
 	if line.Type == lex.TypeSpeaker && strings.TrimSpace(line.Contents) == "" {
-		l.addError(currentLineNum, internal.MsgEmptySpeaker, line.Contents)
+		l.addError(pos, internal.MsgEmptySpeaker, line.Contents)
 	}
 
 	// Check for parentheticals without preceding dialogue/speaker
 	if line.Type == lex.TypeParen && i > 0 {
 		prevType := screenplay[i-1].Type
 		if prevType != lex.TypeSpeaker && prevType != lex.TypeDialog && prevType != lex.TypeParen {
-			l.addError(currentLineNum, internal.MsgMisplacedParenthetical, line.Contents)
+			l.addError(pos, internal.MsgMisplacedParenthetical, line.Contents)
 		}
 	}
 }
 
 // addError appends a new LintError to the linter's error list.
-func (l *Linter) addError(lineNum int, message, context string) {
+func (l *Linter) addError(pos lex.Position, message, context string) {
 	l.Errors = append(l.Errors, LintError{
-		LineNum: lineNum,
+		LineNum: pos.Line,
+		Pos:     pos,
 		Message: message,
 		Context: context,
 	})
 }
 
+// Location describes where the error occurred, e.g. "Line 12, column 5 (script.fountain)".
+func (e LintError) Location() string {
+	loc := fmt.Sprintf("Line %d", e.LineNum)
+	if e.Pos.Col > 0 {
+		loc += fmt.Sprintf(", column %d", e.Pos.Col)
+	}
+	if e.Pos.File != "" {
+		loc += fmt.Sprintf(" (%s)", e.Pos.File)
+	}
+	return loc
+}
+
 // HasErrors returns true if any linting errors were found.
 func (l *Linter) HasErrors() bool {
 	return len(l.Errors) > 0
@@ -103,7 +121,7 @@ func (l *Linter) FormatErrors() string {
 	var sb strings.Builder
 	sb.WriteString("Linting Errors:\n")
 	for _, err := range l.Errors {
-		sb.WriteString(fmt.Sprintf("  Line %d: %s\n    Context: \"%s\"\n", err.LineNum, err.Message, err.Context))
+		sb.WriteString(fmt.Sprintf("  %s: %s\n    Context: \"%s\"\n", err.Location(), err.Message, err.Context))
 	}
 	return sb.String()
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -65,6 +66,9 @@ type Config struct {
 	From         string
 	To           string
 	Lint         bool
+	NumberScenes bool
+	AutoContd    bool
+	Reformat     bool
 	TemplatePath string
 	Help         bool
 	ShowVersion  bool
@@ -78,6 +82,18 @@ type IOFiles struct {
 }
 
 func main() {
+	run := run
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		run = func() error { return runFormat(os.Args[2:]) }
+	}
+	if err := run(); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
+
+// run converts the input as configured by the command line flags. Errors make the program exit non-zero.
+func run() error {
 	ctx, cancel := setupContext()
 	defer cancel()
 
@@ -88,7 +104,7 @@ func main() {
 
 	config := parseFlags()
 	if handleEarlyExits(config) {
-		return
+		return nil
 	}
 
 	detectFormats(config)
@@ -96,10 +112,9 @@ func main() {
 	log.Printf("Scenein: %s ; Sceneout: %s ;\n", config.SceneIn, config.SceneOut)
 
 	conf := rules.GetConf(config.ConfigFile)
-	ioFiles, err := setupIO(config)
+	ioFiles, err := setupInput(config)
 	if err != nil {
-		log.Printf("Error setting up I/O: %v", err)
-		return
+		return fmt.Errorf("error setting up I/O: %w", err)
 	}
 	defer func() {
 		if err := ioFiles.Closer(); err != nil {
@@ -107,20 +122,36 @@ func main() {
 		}
 	}()
 
-	screenplay := parseInput(config, conf, ioFiles.Input)
-	if screenplay == nil {
-		return
+	screenplay, err := parseInput(config, conf, ioFiles.Input)
+	if err != nil {
+		return err
+	}
+
+	if config.NumberScenes {
+		*screenplay = screenplay.NumberScenes()
+	}
+	if config.AutoContd || conf.AutoContd {
+		if addsContd(config.To) {
+			*screenplay = screenplay.AutoContinued(true)
+		} else {
+			log.Printf("Automatic (CONT'D) doesn't apply to %s output, it is left as it is", config.To)
+		}
 	}
 
 	if config.Lint {
 		if handleLinting(*screenplay, config) {
-			return
+			return nil
 		}
 	}
 
+	// The output is only created once the input is parsed, so a parse error leaves an existing file alone
+	if err := setupOutput(config, ioFiles); err != nil {
+		return fmt.Errorf("error setting up I/O: %w", err)
+	}
 	if err := convertOutput(ctx, config, conf, ioFiles.Output, *screenplay); err != nil {
-		log.Printf("Error during conversion: %v", err)
+		return fmt.Errorf("error during conversion: %w", err)
 	}
+	return nil
 }
 
 func setupContext() (context.Context, context.CancelFunc) {
@@ -153,6 +184,13 @@ func parseFlags() *Config {
 			"epub, mobi, docx, odt, rtf, markdown, rst, json, native, man, textile, mediawiki, org, asciidoc, "+
 			"htmlpdf, latexpdf.")
 	flag.BoolVar(&config.Lint, "lint", false, "Run the Fountain linter on the input file")
+	flag.BoolVar(&config.NumberScenes, "numberscenes", false,
+		"Number all scene headings, keeping existing scene numbers locked.")
+	flag.BoolVar(&config.AutoContd, "contd", false,
+		"Add (CONT'D) to characters who speak again after only action, except in Fountain and lex output. "+
+			"Also set with AutoContd in the configuration.")
+	flag.BoolVar(&config.Reformat, "reformat", false,
+		"Write Fountain output anew instead of keeping unchanged elements of Fountain input as they were.")
 	flag.StringVar(&config.TemplatePath, "template", "",
 		"Path to a custom template file (e.g., for HTML, FDX, or LaTeX output).")
 	flag.BoolVar(&config.Help, "help", false, "Show this help message")
@@ -219,7 +257,8 @@ func setDefaults(config *Config) {
 	}
 }
 
-func setupIO(config *Config) (*IOFiles, error) {
+// setupInput opens the input, the output is opened later by setupOutput
+func setupInput(config *Config) (*IOFiles, error) {
 	ioFiles := &IOFiles{
 		Closer: func() error { return nil },
 	}
@@ -235,7 +274,11 @@ func setupIO(config *Config) (*IOFiles, error) {
 		ioFiles.Input = file
 		ioFiles.Closer = file.Close
 	}
+	return ioFiles, nil
+}
 
+// setupOutput creates the output file, or uses Stdout, and closes it together with the input
+func setupOutput(config *Config, ioFiles *IOFiles) error {
 	if config.Output == "-" {
 		ioFiles.Output = os.Stdout
 		log.Println("Writing to Stdout")
@@ -247,7 +290,7 @@ func setupIO(config *Config) (*IOFiles, error) {
 		}
 		outputFile, err := os.Create(config.Output)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		ioFiles.Output = outputFile
 		oldCloser := ioFiles.Closer
@@ -258,27 +301,34 @@ func setupIO(config *Config) (*IOFiles, error) {
 			return oldCloser()
 		}
 	}
-
-	return ioFiles, nil
+	return nil
 }
 
-func parseInput(config *Config, conf rules.TOMLConf, input io.Reader) *lex.Screenplay {
+func parseInput(config *Config, conf rules.TOMLConf, input io.Reader) (*lex.Screenplay, error) {
 	log.Printf("Input type is %s", config.From)
 
 	var screenplay lex.Screenplay
+	var err error
 	switch config.From {
 	case internal.FormatLex:
-		screenplay = lex.Parse(input)
+		screenplay, err = lex.Parse(input)
 	case internal.FormatFountain:
-		screenplay = fountain.Parse(conf.Scenes[config.SceneIn], input)
+		// Fountain output keeps what wasn't changed as it was written, which needs the source text
+		if config.To == internal.FormatFountain && !config.Reformat {
+			screenplay, err = fountain.ParsePreserving(conf.Scenes[config.SceneIn], input)
+		} else {
+			screenplay, err = fountain.Parse(conf.Scenes[config.SceneIn], input)
+		}
 	case internal.FormatFDX:
-		screenplay = fdx.Parse(input)
+		screenplay, err = fdx.Parse(input)
 	default:
-		log.Printf("%s is not a valid input type", config.From)
-		return nil
+		return nil, fmt.Errorf("%s is not a valid input type", config.From)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s input:\n%w", config.From, err)
 	}
 
-	return &screenplay
+	return &screenplay, nil
 }
 
 func handleLinting(screenplay lex.Screenplay, config *Config) bool {
@@ -325,24 +375,39 @@ func convertOutput(ctx context.Context, config *Config, conf rules.TOMLConf, out
 	}
 }
 
+// addsContd returns false for Fountain and lex output, which can't tell an automatic (CONT'D) from
+// one written by hand. Final Draft regenerates its own, so FDX output gets them.
+func addsContd(format string) bool {
+	switch format {
+	case internal.FormatFountain, internal.FormatLex:
+		return false
+	default:
+		return true
+	}
+}
+
 func createWriter(config *Config, conf rules.TOMLConf) writer.Writer {
 	switch config.To {
 	case internal.FormatPDF:
-		if config.Output == "-" {
-			log.Println("Cannot write PDF to standard output. Please provide an output filename (e.g., -o output.pdf).")
-			return nil
+		return &pdf.PDFWriter{
+			Elements: conf.Elements[config.Elements],
+			Page:     conf.Page,
+			Fonts:    conf.Fonts,
 		}
-		return &pdf.PDFWriter{OutputFile: config.Output, Elements: conf.Elements[config.Elements]}
 	case internal.FormatLex:
 		return &lex.LexWriter{}
 	case internal.FormatFountain:
-		return &fountain.FountainWriter{SceneConfig: conf.Scenes[config.SceneOut]}
+		return &fountain.FountainWriter{SceneConfig: conf.Scenes[config.SceneOut], Reformat: config.Reformat}
 	case internal.FormatFDX:
-		return &fdx.FDXWriter{TemplatePath: config.TemplatePath}
+		return &fdx.FDXWriter{TemplatePath: config.TemplatePath, Elements: conf.Elements[config.Elements]}
 	case internal.FormatHTML:
-		return &html.HTMLWriter{Elements: conf.Elements[config.Elements]}
+		return &html.HTMLWriter{Elements: conf.Elements[config.Elements], Page: conf.Page}
 	case internal.FormatLaTeX:
-		return &latex.LaTeXWriter{Template: config.TemplatePath, Elements: conf.Elements[config.Elements]}
+		return &latex.LaTeXWriter{
+			Template: config.TemplatePath,
+			Elements: conf.Elements[config.Elements],
+			Page:     conf.Page,
+		}
 	default:
 		return nil
 	}
@@ -355,7 +420,7 @@ func handlePandocOutput(config *Config, conf rules.TOMLConf, screenplay lex.Scre
 	if config.To == "latexpdf" {
 		return handleLaTeXPDF(config, conf, screenplay)
 	}
-	return handleStandardPandoc(config, screenplay)
+	return handleStandardPandoc(config, conf, screenplay)
 }
 
 func handleHTMLPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenplay) error {
@@ -366,7 +431,7 @@ func handleHTMLPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenpla
 	}
 
 	var htmlBuffer bytes.Buffer
-	htmlWriter := &html.HTMLWriter{Elements: conf.Elements[config.Elements]}
+	htmlWriter := &html.HTMLWriter{Elements: conf.Elements[config.Elements], Page: conf.Page}
 	if htmlErr := htmlWriter.Write(&htmlBuffer, screenplay); htmlErr != nil {
 		log.Printf("Error converting to HTML format for wkhtmltopdf: %v", htmlErr)
 		return htmlErr
@@ -392,8 +457,8 @@ func handleHTMLPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenpla
 		return err
 	}
 
-	cmdArgs := []string{
-		"--page-size", "Letter",
+	cmdArgs := pageSizeArgs(conf.Page)
+	cmdArgs = append(cmdArgs,
 		"--margin-top", "0.75in",
 		"--margin-right", "0.75in",
 		"--margin-bottom", "0.75in",
@@ -402,7 +467,7 @@ func handleHTMLPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenpla
 		"--print-media-type",
 		tempFile.Name(),
 		config.Output,
-	}
+	)
 	cmd := exec.Command(wkhtmltopdf, cmdArgs...)
 	cmd.Stderr = os.Stderr
 
@@ -410,6 +475,17 @@ func handleHTMLPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenpla
 	return cmd.Run()
 }
 
+// pageSizeArgs returns the wkhtmltopdf arguments selecting the configured paper size
+func pageSizeArgs(page rules.Page) []string {
+	if name := page.SizeName(); name != "" {
+		return []string{"--page-size", name}
+	}
+	return []string{
+		"--page-width", fmt.Sprintf("%gin", page.Width),
+		"--page-height", fmt.Sprintf("%gin", page.Height),
+	}
+}
+
 func handleLaTeXPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenplay) error {
 	var latexCmd string
 	if _, err := exec.LookPath("pdflatex"); err == nil {
@@ -425,7 +501,11 @@ func handleLaTeXPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenpl
 	}
 
 	var latexBuffer bytes.Buffer
-	latexWriter := &latex.LaTeXWriter{Template: config.TemplatePath, Elements: conf.Elements[config.Elements]}
+	latexWriter := &latex.LaTeXWriter{
+		Template: config.TemplatePath,
+		Elements: conf.Elements[config.Elements],
+		Page:     conf.Page,
+	}
 	if err := latexWriter.Write(&latexBuffer, screenplay); err != nil {
 		log.Printf("Error converting to LaTeX format: %v", err)
 		return err
@@ -460,7 +540,7 @@ func handleLaTeXPDF(config *Config, conf rules.TOMLConf, screenplay lex.Screenpl
 	return cmd.Run()
 }
 
-func handleStandardPandoc(config *Config, screenplay lex.Screenplay) error {
+func handleStandardPandoc(config *Config, conf rules.TOMLConf, screenplay lex.Screenplay) error {
 	pandoc, err := exec.LookPath("pandoc")
 	if err != nil {
 		log.Printf("Error: '%s' output requires pandoc, but it could not be found in your system's PATH.", config.To)
@@ -471,14 +551,14 @@ func handleStandardPandoc(config *Config, screenplay lex.Screenplay) error {
 	for _, line := range screenplay {
 		switch line.Type {
 		case "Title":
-			title = line.Contents
+			title = strings.ReplaceAll(line.Contents, "\n", " ")
 		case "Author":
-			author = line.Contents
+			author = strings.ReplaceAll(line.Contents, "\n", ", ")
 		}
 	}
 
 	var markdownBuffer bytes.Buffer
-	markdownWriter := &markdown.MarkdownWriter{}
+	markdownWriter := &markdown.MarkdownWriter{Elements: conf.Elements[config.Elements]}
 	if err := markdownWriter.Write(&markdownBuffer, screenplay); err != nil {
 		log.Printf("Error converting to Markdown format for pandoc: %v", err)
 		return err
@@ -3,10 +3,10 @@ package markdown
 import (
 	"fmt"
 	"io"
-	"regexp"
 	"strings"
 
 	"github.com/LaPingvino/lexington/lex"
+	"github.com/LaPingvino/lexington/rules"
 )
 
 // Constants for markdown formatting
@@ -22,34 +22,48 @@ const (
 	dialogueBlockEnd   = "\n"
 )
 
-// Inline markup patterns for Markdown output
-var (
-	bolditalic = regexp.MustCompile(`\*{3}([^\*\n]+)\*{3}`)
-	bold       = regexp.MustCompile(`\*{2}([^\*\n]+)\*{2}`)
-	italic     = regexp.MustCompile(`\*{1}([^\*\n]+)\*{1}`)
-	underline  = regexp.MustCompile(`_{1}([^\*\n]+)_{1}`)
-)
-
 // processInlineMarkup converts fountain-style inline markup to Markdown
 func processInlineMarkup(text string) string {
-	// Only process if the text contains markup characters
-	if !strings.ContainsAny(text, "*_") {
-		return text
-	}
+	var b strings.Builder
+	writeSpans(&b, lex.ParseMarkup(text))
+	return b.String()
+}
 
-	// Apply replacements in order: bold+italic first, then bold, then italic, then underline
-	// This prevents conflicts between overlapping patterns
-	text = bolditalic.ReplaceAllString(text, "***${1}***")
-	text = bold.ReplaceAllString(text, "**${1}**")
-	text = italic.ReplaceAllString(text, "*${1}*")
-	text = underline.ReplaceAllString(text, "<u>${1}</u>") // Markdown doesn't have native underline
+// markdownEscaper escapes text that Markdown would otherwise read as emphasis
+var markdownEscaper = strings.NewReplacer(`*`, `\*`, `_`, `\_`)
 
-	return text
+// writeSpans writes a tree of inline markup spans as Markdown emphasis.
+// Markdown has no underline, so that is written as an HTML tag.
+func writeSpans(b *strings.Builder, spans []lex.Span) {
+	for _, span := range spans {
+		if span.Style == 0 {
+			b.WriteString(markdownEscaper.Replace(span.Text))
+			continue
+		}
+		var marker string
+		if span.Style.Has(lex.Bold) {
+			marker += "**"
+		}
+		if span.Style.Has(lex.Italic) {
+			marker += "*"
+		}
+		if span.Style.Has(lex.Underline) {
+			b.WriteString("<u>")
+		}
+		b.WriteString(marker)
+		writeSpans(b, span.Children)
+		b.WriteString(marker)
+		if span.Style.Has(lex.Underline) {
+			b.WriteString("</u>")
+		}
+	}
 }
 
 // MarkdownWriter implements the writer.Writer interface for Markdown output.
 // This is primarily used as an intermediate format for pandoc conversion.
-type MarkdownWriter struct{}
+type MarkdownWriter struct {
+	Elements rules.Set // Decides whether notes and boneyard are shown, defaults to rules.Default
+}
 
 // Write converts the internal lex.Screenplay format to a Markdown file.
 // It implements the writer.Writer interface.
@@ -60,7 +74,15 @@ func (m *MarkdownWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
 		inDualDialogue: false,
 	}
 
+	elements := m.Elements
+	if elements == nil {
+		elements = rules.Default
+	}
+
 	for _, line := range screenplay {
+		if line.IsAnnotation() && elements.Get(line.Type).Hide {
+			continue
+		}
 		if err := state.processLine(line); err != nil {
 			return err
 		}
@@ -113,6 +135,8 @@ func (s *markdownState) processTitlePageElements(line lex.Line) error {
 		s.inTitlePage = true
 		return nil
 	case "Title":
+		// A heading has to stay on one line
+		line.Contents = strings.ReplaceAll(line.Contents, "\n", " ")
 		return s.processTitlePageElement(line, "# %s\n\n")
 	case "Credit":
 		return s.processTitlePageElement(line, "*%s*\n\n")
@@ -167,14 +191,42 @@ func (s *markdownState) processContentElements(line lex.Line) error {
 		return s.processSectionLine(line)
 	case "synopse":
 		return s.writeFormatted("> %s\n\n", processInlineMarkup(strings.TrimLeft(line.Contents, "= ")))
+	case lex.TypeNote:
+		return s.writeFormatted("*[%s]*\n\n", processInlineMarkup(line.Contents))
+	case lex.TypeBoneyard:
+		return s.writeFormatted("~~%s~~\n\n", strings.TrimSpace(line.Contents))
+	case lex.TypeRevision:
+		// Revision sets only matter for printed drafts
+		return nil
 	default:
 		return s.processDefaultLine(line)
 	}
 }
 
-// processTitlePageElement handles title page elements
+// processTitlePageElement handles title page elements. Values spanning multiple lines
+// are kept together in one paragraph with line breaks.
 func (s *markdownState) processTitlePageElement(line lex.Line, format string) error {
-	return s.writeFormatted(format, processInlineMarkup(line.Contents))
+	return s.writeFormatted(format, paragraph(line.Contents, ""))
+}
+
+// nbsp keeps whitespace that Markdown would otherwise collapse
+const nbsp = "&nbsp;"
+
+// paragraph formats text spanning multiple lines as a single paragraph with hard line breaks.
+// Every line after the first starts with prefix. Leading whitespace and blank lines are kept
+// with non-breaking spaces.
+func paragraph(text, prefix string) string {
+	rows := strings.Split(text, "\n")
+	for i, row := range rows {
+		content := strings.TrimLeft(row, " \t")
+		indent := row[:len(row)-len(content)]
+		indent = strings.ReplaceAll(strings.ReplaceAll(indent, "\t", "    "), " ", nbsp)
+		if content == "" && len(rows) > 1 {
+			indent = nbsp
+		}
+		rows[i] = indent + processInlineMarkup(content)
+	}
+	return strings.Join(rows, "  \n"+prefix)
 }
 
 // processActionLine handles action lines
@@ -183,7 +235,7 @@ func (s *markdownState) processActionLine(line lex.Line) error {
 		return err
 	}
 	if strings.TrimSpace(line.Contents) != "" {
-		return s.writeFormatted("%s\n\n", processInlineMarkup(line.Contents))
+		return s.writeFormatted("%s\n\n", paragraph(line.Contents, ""))
 	}
 	return nil
 }
@@ -194,9 +246,9 @@ func (s *markdownState) processSpeakerLine(line lex.Line) error {
 		return err
 	}
 	if s.inDualDialogue {
-		return s.writeFormatted("%s**%s**  \n", dialogueBlockStart, strings.ToUpper(processInlineMarkup(line.Contents)))
+		return s.writeFormatted("%s**%s**  \n", dialogueBlockStart, strings.ToUpper(processInlineMarkup(line.Text())))
 	}
-	return s.writeFormatted("%s**%s**\n\n", dialogueBlockStart, strings.ToUpper(processInlineMarkup(line.Contents)))
+	return s.writeFormatted("%s**%s**\n\n", dialogueBlockStart, strings.ToUpper(processInlineMarkup(line.Text())))
 }
 
 // processDialogLine handles dialog and lyrics lines
@@ -205,9 +257,9 @@ func (s *markdownState) processDialogLine(line lex.Line) error {
 		return err
 	}
 	if s.inDualDialogue {
-		return s.writeFormatted("%s%s  \n", dialogueBlockStart, processInlineMarkup(line.Contents))
+		return s.writeFormatted("%s%s  \n", dialogueBlockStart, paragraph(line.Contents, dialogueBlockStart))
 	}
-	return s.writeFormatted("%s%s\n\n", dialogueBlockStart, processInlineMarkup(line.Contents))
+	return s.writeFormatted("%s%s\n\n", dialogueBlockStart, paragraph(line.Contents, dialogueBlockStart))
 }
 
 // processParenLine handles parenthetical lines
@@ -298,9 +298,11 @@ func TestProcessInlineMarkupFunction(t *testing.T) {
 		{"Complex mixed",
 			"***Bold italic*** with **bold** and *italic* and _underlined_",
 			"***Bold italic*** with **bold** and *italic* and <u>underlined</u>"},
-		{"Empty markup", "**", "**"},
-		{"Single asterisk", "*", "*"},
-		{"Single underscore", "_", "_"},
+		{"Empty markup", "**", `\*\*`},
+		{"Single asterisk", "*", `\*`},
+		{"Single underscore", "_", `\_`},
+		{"Escaped markup", `\*not italic\*`, `\*not italic\*`},
+		{"Nested markup", "_**bold underlined**_", "<u>**bold underlined**</u>"},
 		{"No markup chars", "Plain text without markup", "Plain text without markup"},
 	}
 
@@ -508,3 +510,27 @@ func TestEmptyLinesAndSpacing(t *testing.T) {
 		t.Error("Expected action line after dialogue block")
 	}
 }
+
+// TestParagraphs tests that elements spanning multiple lines keep their line breaks and indentation
+func TestParagraphs(t *testing.T) {
+	screenplay := lex.Screenplay{
+		lex.Line{Type: lex.TypeAction, Contents: "Mary waits.\n  The clock ticks.\n\nNothing."},
+		lex.Line{Type: lex.TypeEmpty},
+		lex.Line{Type: lex.TypeSpeaker, Contents: "MARY"},
+		lex.Line{Type: lex.TypeDialog, Contents: "Hello?\nAnyone?"},
+	}
+
+	var buffer bytes.Buffer
+	writer := &MarkdownWriter{}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("MarkdownWriter.Write returned an unexpected error: %v", err)
+	}
+	markdownOutput := buffer.String()
+
+	if !strings.Contains(markdownOutput, "Mary waits.  \n&nbsp;&nbsp;The clock ticks.  \n&nbsp;  \nNothing.\n\n") {
+		t.Errorf("Expected the action to keep its line breaks and indentation, got:\n%s", markdownOutput)
+	}
+	if !strings.Contains(markdownOutput, "> Hello?  \n> Anyone?\n\n") {
+		t.Errorf("Expected the dialogue rows to stay in the block quote, got:\n%s", markdownOutput)
+	}
+}
@@ -5,7 +5,6 @@ package pdf
 
 import (
 	"io"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -19,30 +18,60 @@ import (
 
 // PDFWriter implements the writer.Writer interface for PDF output.
 type PDFWriter struct {
+	// OutputFile is only used when Write is called with a nil writer.
+	//
+	// Deprecated: pass the destination to Write instead.
 	OutputFile string
 	Elements   rules.Set
+	Page       rules.Page
+	Fonts      map[string]rules.FontFiles // Font families loaded from files, by family name
 }
 
 type Tree struct {
 	PDF          *gofpdf.Fpdf
 	Rules        rules.Set
 	F            lex.Screenplay
-	HTML         gofpdf.HTMLBasicType
 	DualDialogue bool       // Track if we're in dual dialogue mode
 	DualColumn   int        // Track which column we're in (0 = left, 1 = right)
 	DualBuffer   []lex.Line // Buffer for dual dialogue elements
+	Page         rules.Page // Page numbering, header and footer settings
+
+	fonts map[string]typeface // Font families loaded from files
+
+	numbered   bool   // Pages get numbers, false while on the title page
+	pageLabel  string // Number of the current page, empty if it isn't numbered
+	lockedPage string // Number of the next page as set by a locked page break
+	bodyPages  int    // Number of pages since the title page
+	revision   string // Name of the revision printed in the header
 }
 
 func (t Tree) pr(a string, text string) {
-	linePrint(t.PDF, t.Rules.Get(a), t.HTML, t.Rules.Get(a).Prefix+text+t.Rules.Get(a).Postfix)
+	t.linePrint(t.Rules.Get(a), t.Rules.Get(a).Prefix+text+t.Rules.Get(a).Postfix)
+}
+
+// prLine prints the contents of a line, with revision marks if the line was revised
+func (t Tree) prLine(line lex.Line, text string) {
+	page, y := t.PDF.PageNo(), t.PDF.GetY()
+	// Forced transitions keep the case they were written in
+	if line.Type == lex.TypeTrans {
+		text = strings.ToUpper(text)
+	}
+	t.pr(line.Type, text)
+	if line.Revision > 0 {
+		t.markRevision(page, y)
+	}
 }
 
 func (t *Tree) Render() {
-	var block string
 	var lastsection int
 
-	for _, row := range t.F {
-		if t.handleSpecialCases(row, &block, &lastsection) {
+	for i := 0; i < len(t.F); i++ {
+		row := t.F[i]
+		if row.Type == lex.TypeTitlePage {
+			i = t.renderTitlePage(i)
+			continue
+		}
+		if t.handleSpecialCases(row, &lastsection) {
 			continue
 		}
 
@@ -52,19 +81,38 @@ func (t *Tree) Render() {
 			continue
 		}
 
+		// Paginate the screenplay body
+		if !t.shouldSkipElement(row) {
+			switch row.Type {
+			case lex.TypeEmpty:
+				if t.atPageTop() {
+					continue
+				}
+			case lex.TypeSpeaker:
+				i = t.renderDialogue(i)
+				continue
+			case lex.TypeAction:
+				if t.renderAction(i) {
+					continue
+				}
+			default:
+				t.breakBefore(i)
+			}
+		}
+
 		contents, level := t.processBookmarkContent(row, lastsection)
 		if contents != "" {
 			t.PDF.Bookmark(contents, level, -1)
 		}
 
-		if t.shouldSkipElement(row, block) {
+		if t.shouldSkipElement(row) {
 			continue
 		}
 
-		if block == internal.ElementTitle {
-			row.Type = block
+		if row.Type == lex.TypeScene && row.SceneNumber != "" {
+			t.printSceneNumber(row.SceneNumber)
 		}
-		t.pr(row.Type, row.Contents)
+		t.prLine(row, row.Text())
 	}
 
 	// Flush any remaining dual dialogue at the end
@@ -74,31 +122,18 @@ func (t *Tree) Render() {
 }
 
 // handleSpecialCases processes special element types that require immediate action
-func (t *Tree) handleSpecialCases(row lex.Line, block *string, lastsection *int) bool {
+func (t *Tree) handleSpecialCases(row lex.Line, lastsection *int) bool {
 	switch row.Type {
 	case "newpage":
 		if t.DualDialogue {
 			t.flushDualDialogue()
 		}
-		*block = ""
+		t.numbered = true
+		t.lockedPage = row.Contents
 		t.PDF.AddPage()
-		t.PDF.SetHeaderFuncMode(func() {
-			t.PDF.SetFont("CourierPrime", "", 12)
-			t.PDF.SetXY(-1, 0.5)
-			t.PDF.Cell(0, 0, strconv.Itoa(t.PDF.PageNo()-1)+".")
-		}, true)
 		return true
-	case "titlepage":
-		*block = internal.ElementTitle
-		t.PDF.SetY(4)
-		return false
-	case "title", "Title":
-		t.PDF.SetTitle(row.Contents, true)
-		return false
-	case "metasection":
-		*block = ""
-		t.PDF.SetY(-2)
-		return false
+	case lex.TypeRevision:
+		return true
 	case "dualspeaker_open":
 		t.DualDialogue = true
 		t.DualColumn = 0
@@ -117,6 +152,22 @@ func (t *Tree) handleSpecialCases(row lex.Line, block *string, lastsection *int)
 	return false
 }
 
+// printSceneNumber prints a scene number in both margins, level with the scene heading
+func (t Tree) printSceneNumber(number string) {
+	format := t.Rules.Get(lex.TypeScene)
+	pageWidth, _ := t.PDF.GetPageSize()
+	y := t.PDF.GetY()
+
+	setFont(t.PDF, t.typeface(format.Font), format.Style, format.Size)
+	t.PDF.SetLeftMargin(0)
+	t.PDF.SetRightMargin(0)
+	t.PDF.SetXY(format.Left-1, y)
+	t.PDF.CellFormat(0.75, lineHeight, number, "", 0, "R", false, 0, "")
+	t.PDF.SetXY(pageWidth-format.Right+0.25, y)
+	t.PDF.CellFormat(0.75, lineHeight, number, "", 0, "L", false, 0, "")
+	t.PDF.SetXY(0, y)
+}
+
 // bufferDualDialogue adds a line to the dual dialogue buffer
 func (t *Tree) bufferDualDialogue(row lex.Line) {
 	lineCopy := row
@@ -143,17 +194,10 @@ func (t *Tree) processBookmarkContent(row lex.Line, lastsection int) (string, in
 }
 
 // shouldSkipElement determines if an element should be skipped
-func (t *Tree) shouldSkipElement(row lex.Line, block string) bool {
-	return t.Rules.Get(row.Type).Hide && block == ""
+func (t *Tree) shouldSkipElement(row lex.Line) bool {
+	return t.Rules.Get(row.Type).Hide
 }
 
-var (
-	bolditalic = regexp.MustCompile("\\*{3}([^\\*\n]+)\\*{3}")
-	bold       = regexp.MustCompile("\\*{2}([^\\*\n]+)\\*{2}")
-	italic     = regexp.MustCompile("\\*{1}([^\\*\n]+)\\*{1}")
-	underline  = regexp.MustCompile("_{1}([^\\*\n]+)_{1}")
-)
-
 func (t *Tree) flushDualDialogue() {
 	if len(t.DualBuffer) == 0 {
 		return
@@ -180,6 +224,11 @@ func (t *Tree) flushDualDialogue() {
 		},
 	)
 
+	// Keep both speeches together on one page
+	if t.dualHeight(leftElements, rightElements) > t.remaining() && !t.atPageTop() {
+		t.PDF.AddPage()
+	}
+
 	// Store original position and margins
 	startY := t.PDF.GetY()
 
@@ -199,43 +248,29 @@ func (t *Tree) flushDualDialogue() {
 	// Render left column using precise positioning
 	leftCurrentY := startY
 	for _, line := range leftElements {
-		lineType := line.Type
-		var format rules.Format
-		switch lineType {
-		case "speaker":
-			format = t.Rules.Get("dualspeaker")
-		case "dialog":
-			format = t.Rules.Get("dualdialog")
-		case "paren":
-			format = t.Rules.Get("dualparen")
-		default:
-			format = t.Rules.Get(lineType)
-		}
+		format := t.dualFormat(line.Type)
 
 		// Position text in left column
 		t.PDF.SetXY(leftColStart+format.Left-1.5, leftCurrentY)
-		leftCurrentY += t.renderDualDialogueLine(format, line.Contents, leftColWidth)
+		lineY := leftCurrentY
+		leftCurrentY += t.renderDualDialogueLine(format, line.Text(), leftColWidth)
+		if line.Revision > 0 {
+			t.markLines(lineY, leftCurrentY)
+		}
 	}
 
 	// Render right column using precise positioning
 	rightCurrentY := startY
 	for _, line := range rightElements {
-		lineType := line.Type
-		var format rules.Format
-		switch lineType {
-		case "speaker":
-			format = t.Rules.Get("dualspeaker")
-		case "dialog":
-			format = t.Rules.Get("dualdialog")
-		case "paren":
-			format = t.Rules.Get("dualparen")
-		default:
-			format = t.Rules.Get(lineType)
-		}
+		format := t.dualFormat(line.Type)
 
 		// Position text in right column
 		t.PDF.SetXY(rightColStart+format.Left-1.5, rightCurrentY)
-		rightCurrentY += t.renderDualDialogueLine(format, line.Contents, rightColWidth)
+		lineY := rightCurrentY
+		rightCurrentY += t.renderDualDialogueLine(format, line.Text(), rightColWidth)
+		if line.Revision > 0 {
+			t.markLines(lineY, rightCurrentY)
+		}
 	}
 
 	// Set final position to the maximum of both columns
@@ -250,58 +285,55 @@ func (t *Tree) flushDualDialogue() {
 	t.PDF.SetRightMargin(origRightMargin)
 }
 
-func linePrint(pdf *gofpdf.Fpdf, format rules.Format, html gofpdf.HTMLBasicType, text string) {
-	// Map configuration font names to PDF font names
-	fontName := font.GetFontName(format.Font)
+// dualFormat returns the format of an element inside dual dialogue
+func (t Tree) dualFormat(lineType string) rules.Format {
+	switch lineType {
+	case "speaker":
+		return t.Rules.Get("dualspeaker")
+	case "dialog":
+		return t.Rules.Get("dualdialog")
+	case "paren":
+		return t.Rules.Get("dualparen")
+	default:
+		return t.Rules.Get(lineType)
+	}
+}
 
-	pdf.SetFont(fontName, format.Style, format.Size)
+func (t Tree) linePrint(format rules.Format, text string) {
+	pdf := t.PDF
+	face := t.typeface(format.Font)
+
+	setFont(pdf, face, format.Style, format.Size)
 	pdf.SetX(0)
 	pdf.SetLeftMargin(format.Left)
 	pdf.SetRightMargin(format.Right)
 
-	text = strings.TrimRight(text, "\r\n")
-
-	if strings.ContainsAny(text, "*_") {
-		text = bolditalic.ReplaceAllString(text, "<b><i>${1}</i></b>")
-		text = bold.ReplaceAllString(text, "<b>${1}</b>")
-		text = italic.ReplaceAllString(text, "<i>${1}</i>")
-		text = underline.ReplaceAllString(text, "<u>${1}</u>")
+	text = expandTabs(strings.TrimRight(text, "\r\n"))
 
-		if format.Align == "C" {
-			text = "<center>" + text + "</center>"
-		}
-		html.Write(0.165, text)
-		pdf.SetY(pdf.GetY() + 0.165)
+	if runs := lex.MarkupRuns(text); !isPlain(runs) {
+		writeStyled(pdf, face, format.Style, format.Size, format.Align, runs)
 		return
 	}
 
-	pdf.MultiCell(0, 0.165, text, "", format.Align, false)
+	pdf.MultiCell(0, lineHeight, lex.PlainText(text), "", format.Align, false)
 }
 
 // renderDualDialogueLine renders a single line of dual dialogue and returns the height consumed
 func (t Tree) renderDualDialogueLine(format rules.Format, text string, columnWidth float64) float64 {
-	// Map configuration font names to PDF font names
-	fontName := font.GetFontName(format.Font)
-
-	t.PDF.SetFont(fontName, format.Style, format.Size)
-	text = strings.TrimRight(text, "\r\n")
-
-	lineHeight := 0.165
-
-	if strings.ContainsAny(text, "*_") {
-		text = bolditalic.ReplaceAllString(text, "<b><i>${1}</i></b>")
-		text = bold.ReplaceAllString(text, "<b>${1}</b>")
-		text = italic.ReplaceAllString(text, "<i>${1}</i>")
-		text = underline.ReplaceAllString(text, "<u>${1}</u>")
-
-		if format.Align == "C" {
-			text = "<center>" + text + "</center>"
-		}
-
-		// For HTML-styled text, use current position and write directly
-		t.HTML.Write(lineHeight, text)
-		return lineHeight
+	face := t.typeface(format.Font)
+
+	setFont(t.PDF, face, format.Style, format.Size)
+	text = expandTabs(strings.TrimRight(text, "\r\n"))
+
+	if runs := lex.MarkupRuns(text); !isPlain(runs) {
+		// Confine the styled text to the column
+		x := t.PDF.GetX()
+		pageWidth, _ := t.PDF.GetPageSize()
+		t.PDF.SetLeftMargin(x)
+		t.PDF.SetRightMargin(pageWidth - x - columnWidth)
+		return writeStyled(t.PDF, face, format.Style, format.Size, format.Align, runs)
 	}
+	text = lex.PlainText(text)
 
 	// For regular text, use MultiCell with constrained width
 	currentY := t.PDF.GetY()
@@ -316,12 +348,44 @@ func (t Tree) renderDualDialogueLine(format rules.Format, text string, columnWid
 	return heightUsed
 }
 
-// Write converts the internal lex.Screenplay format to a PDF file.
+// Write converts the internal lex.Screenplay format to a PDF document written to w.
 // It implements the writer.Writer interface.
-// Note: For PDF, the 'w io.Writer' argument is currently ignored as gofpdf
-// requires a file path for output. The output file path is taken from PDFWriter.OutputFile.
+// For backwards compatibility, the document is written to OutputFile if w is nil.
 func (p *PDFWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
-	pdf := gofpdf.New("P", "in", "Letter", "")
+	width, height, err := p.Page.Dimensions()
+	if err != nil {
+		return err
+	}
+	pdf := newDocument(width, height)
+	fonts, err := loadFonts(pdf, p.Fonts)
+	if err != nil {
+		return err
+	}
+	f := &Tree{
+		PDF:          pdf,
+		Rules:        p.Elements.ForWidth(width),
+		F:            screenplay, // Use the screenplay passed to the Write method
+		DualDialogue: false,
+		DualColumn:   0,
+		DualBuffer:   []lex.Line{},
+		Page:         p.Page,
+		fonts:        fonts,
+	}
+	f.Begin()
+	f.Render()
+	if w == nil {
+		return pdf.OutputFileAndClose(p.OutputFile)
+	}
+	return pdf.Output(w)
+}
+
+// newDocument creates a document with the given paper size in inches and the fonts loaded
+func newDocument(width, height float64) *gofpdf.Fpdf {
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "in",
+		Size:           gofpdf.SizeType{Wd: width, Ht: height},
+	})
 
 	// Load fonts using modern embed approach
 	pdf.AddUTF8FontFromBytes("CourierPrime", "", font.GetFont("CourierPrime", ""))
@@ -331,22 +395,7 @@ func (p *PDFWriter) Write(w io.Writer, screenplay lex.Screenplay) error {
 
 	// Set default font for the document
 	pdf.SetFont("CourierPrime", "", 12)
-	pdf.AddPage()
 	pdf.SetMargins(1, 1, 1)
-	pdf.SetXY(1, 1)
-	f := &Tree{
-		PDF:          pdf,
-		Rules:        p.Elements, // Use the Elements from the PDFWriter struct
-		F:            screenplay, // Use the screenplay passed to the Write method
-		HTML:         pdf.HTMLBasicNew(),
-		DualDialogue: false,
-		DualColumn:   0,
-		DualBuffer:   []lex.Line{},
-	}
-	f.Render()
-	err := pdf.OutputFileAndClose(p.OutputFile) // Use the OutputFile from the PDFWriter struct
-	if err != nil {
-		return err // Return the error instead of panicking
-	}
-	return nil
+	pdf.SetAutoPageBreak(true, 1)
+	return pdf
 }
@@ -0,0 +1,91 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/LaPingvino/lexington/font"
+	"github.com/LaPingvino/lexington/rules"
+
+	"github.com/phpdave11/gofpdf"
+)
+
+// styleNames are the names of the gofpdf styles as used in the configuration
+var styleNames = map[string]string{"": "Regular", "B": "Bold", "I": "Italic", "BI": "BoldItalic"}
+
+// typeface returns the document font family to use for a font name from the configuration.
+// Families configured in Fonts are used as they are, other names fall back to the embedded Courier.
+func (t Tree) typeface(configFont string) typeface {
+	if face, ok := t.fonts[configFont]; ok {
+		return face
+	}
+	// The embedded Courier has no bold faces, bold is synthesized when printing
+	return typeface{name: font.GetFontName(configFont), bold: false, boldItalic: false}
+}
+
+// loadFonts reads the configured font files and registers them with the document.
+// Italic styles without a file use the regular face, bold styles without a file
+// are synthesized when printing.
+func loadFonts(pdf *gofpdf.Fpdf, families map[string]rules.FontFiles) (map[string]typeface, error) {
+	faces := make(map[string]typeface, len(families))
+
+	names := make([]string, 0, len(families))
+	for family := range families {
+		names = append(names, family)
+	}
+	slices.Sort(names)
+
+	for _, family := range names {
+		styles := families[family].Styles()
+		if styles[""] == "" {
+			return nil, fmt.Errorf("font %s: no Regular file configured", family)
+		}
+
+		data := make(map[string][]byte, len(styleNames))
+		for style, file := range styles {
+			b, err := os.ReadFile(file)
+			if err == nil {
+				err = checkFontData(b)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("font %s: cannot use %s file %s: %w", family, styleNames[style], file, err)
+			}
+			data[style] = b
+		}
+		if data["I"] == nil {
+			data["I"] = data[""]
+		}
+		if data["B"] == nil {
+			data["B"] = data[""]
+		}
+		if data["BI"] == nil {
+			data["BI"] = data["I"]
+		}
+
+		for _, style := range []string{"", "B", "I", "BI"} {
+			pdf.AddUTF8FontFromBytes(family, style, data[style])
+		}
+		if err := pdf.Error(); err != nil {
+			return nil, fmt.Errorf("font %s: %w", family, err)
+		}
+		faces[family] = typeface{name: family, bold: styles["B"] != "", boldItalic: styles["BI"] != ""}
+	}
+	return faces, nil
+}
+
+// checkFontData makes sure the data is a font gofpdf can embed, as it only logs invalid fonts
+func checkFontData(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("not a font file")
+	}
+	switch string(data[:4]) {
+	case "\x00\x01\x00\x00", "true":
+		return nil
+	case "OTTO":
+		return errors.New("OpenType fonts with PostScript outlines are not supported, use TrueType outlines")
+	default:
+		return errors.New("not a TrueType or OpenType font")
+	}
+}
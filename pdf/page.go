@@ -0,0 +1,132 @@
+package pdf
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/LaPingvino/lexington/lex"
+)
+
+// Begin sets up the page header and footer and starts the first page.
+// It has to be called once before Render.
+func (t *Tree) Begin() {
+	t.Page = t.Page.WithDefaults()
+	t.revision = t.Page.Revision
+	if t.revision == "" {
+		t.revision = t.F.LatestRevision()
+	}
+	t.numbered = !slices.ContainsFunc(t.F, func(line lex.Line) bool {
+		return line.Type == lex.TypeTitlePage
+	})
+	t.PDF.SetHeaderFuncMode(t.header, true)
+	t.PDF.SetFooterFunc(t.footer)
+	t.PDF.AddPage()
+}
+
+// nextPageLabel returns the number of a new page. A locked page break sets the number of the
+// page after it, e.g. 12A. Other pages count on from the number without its suffix, so the
+// page after 12A becomes 13.
+func (t *Tree) nextPageLabel() string {
+	if t.lockedPage != "" {
+		label := t.lockedPage
+		t.lockedPage = ""
+		return label
+	}
+	digits := len(t.pageLabel) - len(strings.TrimLeft(t.pageLabel, "0123456789"))
+	return lex.NextNumber(t.pageLabel[:digits])
+}
+
+// headerCell is a text printed in the page header
+type headerCell struct {
+	text  string
+	align string  // L, C or R across the width of the page
+	y     float64 // Distance from the top of the page in inches
+}
+
+// header prints the page number, header text and revision on every page after the title page.
+func (t *Tree) header() {
+	if !t.numbered {
+		return
+	}
+	t.pageLabel = t.nextPageLabel()
+	t.bodyPages++
+
+	pageWidth, _ := t.PDF.GetPageSize()
+	t.setPageFont()
+	for _, cell := range t.headerCells() {
+		t.PDF.SetXY(1, cell.y)
+		t.PDF.CellFormat(pageWidth-2, lineHeight, cell.text, "", 0, cell.align, false, 0, "")
+	}
+}
+
+// headerCells lays out the header of the current page. The page number goes where NumberAlign puts it,
+// the header text on the left, or on the right when the number is on the left, and the revision in the
+// middle, or on the right when the number is in the middle. A text that would run into one placed
+// before it goes on the line below.
+func (t *Tree) headerCells() []headerCell {
+	headerAlign, revisionAlign := "L", "C"
+	switch t.Page.NumberAlign {
+	case "L":
+		headerAlign = "R"
+	case "C":
+		revisionAlign = "R"
+	}
+
+	var cells []headerCell
+	if !t.Page.HideNumbers && (!t.Page.SkipFirstNumber || t.bodyPages > 1) {
+		number := strings.Replace(t.Page.NumberFormat, "%s", t.pageLabel, 1)
+		cells = t.placeCell(cells, headerCell{text: number, align: t.Page.NumberAlign})
+	}
+	if t.Page.Header != "" {
+		cells = t.placeCell(cells, headerCell{text: t.Page.Header, align: headerAlign})
+	}
+	if t.revision != "" {
+		cells = t.placeCell(cells, headerCell{text: t.revision, align: revisionAlign})
+	}
+	return cells
+}
+
+// placeCell adds a cell to the header on the first line from HeaderY where it doesn't overlap another
+func (t *Tree) placeCell(cells []headerCell, cell headerCell) []headerCell {
+	cell.y = t.Page.HeaderY
+	gap := t.PDF.GetStringWidth(" ")
+	left, right := t.cellSpan(cell)
+	for slices.ContainsFunc(cells, func(other headerCell) bool {
+		otherLeft, otherRight := t.cellSpan(other)
+		return other.y == cell.y && left < otherRight+gap && otherLeft < right+gap
+	}) {
+		cell.y += lineHeight
+	}
+	return append(cells, cell)
+}
+
+// cellSpan returns where the text of a header cell starts and ends on the page in inches
+func (t *Tree) cellSpan(cell headerCell) (float64, float64) {
+	pageWidth, _ := t.PDF.GetPageSize()
+	width := t.PDF.GetStringWidth(cell.text)
+	switch cell.align {
+	case "C":
+		return (pageWidth - width) / 2, (pageWidth + width) / 2
+	case "R":
+		return pageWidth - 1 - width, pageWidth - 1
+	default:
+		return 1, 1 + width
+	}
+}
+
+// footer prints the footer text on every page after the title page
+func (t *Tree) footer() {
+	if t.pageLabel == "" || t.Page.Footer == "" {
+		return
+	}
+	pageWidth, pageHeight := t.PDF.GetPageSize()
+	t.setPageFont()
+	t.PDF.SetXY(1, pageHeight-t.Page.FooterY-lineHeight)
+	t.PDF.CellFormat(pageWidth-2, lineHeight, t.Page.Footer, "", 0, "C", false, 0, "")
+}
+
+// setPageFont selects the font of the action format for headers and footers
+func (t Tree) setPageFont() {
+	format := t.Rules.Get(lex.TypeAction)
+	setFont(t.PDF, t.typeface(format.Font), "", format.Size)
+}
@@ -0,0 +1,312 @@
+package pdf
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/LaPingvino/lexington/lex"
+	"github.com/LaPingvino/lexington/rules"
+)
+
+// Pagination follows the usual screenplay conventions:
+//   - dialogue is only split at sentence boundaries, with (MORE) at the bottom
+//     of the page and NAME (CONT'D) at the top of the next one,
+//   - action is only split at sentence boundaries as well,
+//   - scene headings stay with the start of the element that follows them,
+//   - transitions stay with the element before them, so they never start a page,
+//   - blank lines at the top of a page are dropped.
+
+const (
+	lineHeight      = 0.165 // Height of a single printed line in inches
+	minSplitLines   = 2     // Minimum number of lines on both sides of a split
+	dualColumnWidth = 2.0   // Width of a dual dialogue column in inches
+	moreMarker      = "(MORE)"
+	contdExtension  = "CONT'D"
+)
+
+// sentenceEnd matches the end of a sentence including trailing quotes and whitespace.
+var sentenceEnd = regexp.MustCompile(`[.!?…]+["'’”)\]]*\s+`)
+
+// tabs are printed as four spaces, as the fonts have no tab stops
+var tabs = strings.NewReplacer("\t", "    ")
+
+// expandTabs replaces the tabs in text with spaces
+func expandTabs(text string) string {
+	return tabs.Replace(text)
+}
+
+// remaining returns the vertical space left on the current page
+func (t Tree) remaining() float64 {
+	_, pageHeight := t.PDF.GetPageSize()
+	_, bottom := t.PDF.GetAutoPageBreak()
+	return pageHeight - bottom - t.PDF.GetY()
+}
+
+// atPageTop returns true if nothing has been printed on the current page yet
+func (t Tree) atPageTop() bool {
+	_, top, _, _ := t.PDF.GetMargins()
+	return t.PDF.GetY() <= top+0.001
+}
+
+// lineCount returns the number of lines text takes up when printed with the given format
+func (t Tree) lineCount(format rules.Format, text string) int {
+	pageWidth, _ := t.PDF.GetPageSize()
+	return t.lineCountWidth(format, text, pageWidth-format.Left-format.Right)
+}
+
+// lineCountWidth returns the number of lines text takes up when wrapped at the given width
+func (t Tree) lineCountWidth(format rules.Format, text string, width float64) int {
+	t.PDF.SetFont(t.typeface(format.Font).name, format.Style, format.Size)
+	width -= 2 * t.PDF.GetCellMargin()
+	space := t.PDF.GetStringWidth(" ")
+
+	count := 0
+	for _, paragraph := range strings.Split(expandTabs(lex.PlainText(text)), "\n") {
+		count++
+		// Indentation at the start of a row takes up room as well
+		lineWidth := t.PDF.GetStringWidth(paragraph[:len(paragraph)-len(strings.TrimLeft(paragraph, " "))])
+		for _, word := range strings.Fields(paragraph) {
+			w := t.PDF.GetStringWidth(word)
+			if lineWidth > 0 && lineWidth+space+w > width {
+				count++
+				lineWidth = w
+				continue
+			}
+			if lineWidth > 0 {
+				lineWidth += space
+			}
+			lineWidth += w
+		}
+	}
+	return count
+}
+
+// height returns the vertical space a line takes up when printed
+func (t Tree) height(line lex.Line) float64 {
+	format := t.Rules.Get(line.Type)
+	return float64(t.lineCount(format, format.Prefix+line.Text()+format.Postfix)) * lineHeight
+}
+
+// isHiddenAnnotation returns true for notes and boneyard that won't be printed
+func (t Tree) isHiddenAnnotation(line lex.Line) bool {
+	return line.IsAnnotation() && t.Rules.Get(line.Type).Hide
+}
+
+// transitionHeight returns the height of a transition following index i, including
+// the blank lines before it, or 0 if the next printed element isn't a transition.
+func (t Tree) transitionHeight(i int) float64 {
+	var height float64
+	for ; i < len(t.F); i++ {
+		switch {
+		case t.F[i].Type == lex.TypeEmpty:
+			height += lineHeight
+		case t.isHiddenAnnotation(t.F[i]):
+		case t.F[i].Type == lex.TypeTrans:
+			return height + t.height(t.F[i])
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// leadHeight returns the height of the blank lines and the first lines of the element
+// following index i, which a scene heading has to be kept together with.
+func (t Tree) leadHeight(i int) float64 {
+	var height float64
+	for ; i < len(t.F); i++ {
+		row := t.F[i]
+		switch {
+		case row.Type == lex.TypeEmpty:
+			height += lineHeight
+		case t.isHiddenAnnotation(row):
+		case row.Type == lex.TypeSpeaker:
+			height += t.height(row)
+			if i+1 < len(t.F) && t.F[i+1].IsDialogueElement() {
+				height += min(t.height(t.F[i+1]), minSplitLines*lineHeight)
+			}
+			return height
+		default:
+			return height + min(t.height(row), minSplitLines*lineHeight)
+		}
+	}
+	return height
+}
+
+// breakBefore starts a new page before the element at index i if the element
+// and everything that has to stay with it doesn't fit on the current page.
+func (t *Tree) breakBefore(i int) {
+	if t.atPageTop() {
+		return
+	}
+	row := t.F[i]
+	needed := t.height(row)
+	if row.Type == lex.TypeScene {
+		needed += t.leadHeight(i + 1)
+	} else {
+		needed += t.transitionHeight(i + 1)
+	}
+	if needed > t.remaining() {
+		t.PDF.AddPage()
+	}
+}
+
+// renderAction prints an action element that doesn't fit on the current page by splitting
+// it at a sentence boundary. It returns false if the action still has to be printed.
+func (t *Tree) renderAction(i int) bool {
+	row := t.F[i]
+	if t.atPageTop() || t.height(row)+t.transitionHeight(i+1) <= t.remaining() {
+		return false
+	}
+	format := t.Rules.Get(row.Type)
+	first, rest, ok := t.splitSentences(format, row.Contents, t.remaining(), minSplitLines, minSplitLines)
+	if !ok {
+		t.PDF.AddPage()
+		return false
+	}
+	t.prLine(row, first)
+	t.PDF.AddPage()
+	t.prLine(row, rest)
+	return true
+}
+
+// renderDialogue prints the speech starting with the speaker at index i and returns the
+// index of its last element. Speeches that don't fit on the page are split at a sentence
+// or element boundary, marked with (MORE) and continued on the next page.
+func (t *Tree) renderDialogue(i int) int {
+	speaker := t.F[i]
+	var parts []lex.Line
+	end := i
+	for j := i + 1; j < len(t.F); j++ {
+		row := t.F[j]
+		if t.isHiddenAnnotation(row) {
+			end = j
+			continue
+		}
+		if row.Type != lex.TypeDialog && row.Type != lex.TypeParen {
+			break
+		}
+		parts = append(parts, row)
+		end = j
+	}
+	tail := t.transitionHeight(end + 1)
+
+	for {
+		speakerHeight := t.height(speaker)
+		needed := speakerHeight + tail
+		for _, part := range parts {
+			needed += t.height(part)
+		}
+		if needed <= t.remaining() || t.atPageTop() && len(parts) == 0 {
+			t.printSpeech(speaker, parts)
+			return end
+		}
+
+		first, rest, ok := t.splitDialogue(parts, t.remaining()-speakerHeight-lineHeight)
+		if !ok {
+			if t.atPageTop() {
+				// Nothing better to do than to let the speech run over the page
+				t.printSpeech(speaker, parts)
+				return end
+			}
+			t.PDF.AddPage()
+			continue
+		}
+
+		t.printSpeech(speaker, first)
+		t.linePrint(t.Rules.Get(lex.TypeSpeaker), moreMarker)
+		t.PDF.AddPage()
+		speaker = continued(speaker)
+		parts = rest
+	}
+}
+
+// printSpeech prints a speaker followed by the parentheticals and dialogue
+func (t Tree) printSpeech(speaker lex.Line, parts []lex.Line) {
+	t.prLine(speaker, speaker.Text())
+	for _, part := range parts {
+		t.prLine(part, part.Contents)
+	}
+}
+
+// continued returns the speaker line used at the top of the next page, e.g. MARY (CONT'D)
+func continued(speaker lex.Line) lex.Line {
+	if !speaker.HasExtension(contdExtension) {
+		speaker.Extensions = append(slices.Clone(speaker.Extensions), contdExtension)
+	}
+	return speaker
+}
+
+// splitDialogue splits the parentheticals and dialogue of a speech so that the first part
+// fits in avail. Splits happen after a dialogue element or at a sentence boundary inside one,
+// never right after a parenthetical.
+func (t Tree) splitDialogue(parts []lex.Line, avail float64) ([]lex.Line, []lex.Line, bool) {
+	var used float64
+	lines := 0
+	boundary := -1
+	for k, part := range parts {
+		format := t.Rules.Get(part.Type)
+		count := t.lineCount(format, format.Prefix+part.Contents+format.Postfix)
+		height := float64(count) * lineHeight
+		if used+height <= avail {
+			used += height
+			lines += count
+			if part.Type == lex.TypeDialog && k < len(parts)-1 && lines >= minSplitLines {
+				boundary = k + 1
+			}
+			continue
+		}
+
+		if part.Type == lex.TypeDialog {
+			minFirst := max(minSplitLines-lines, 1)
+			if first, rest, ok := t.splitSentences(format, part.Contents, avail-used, minFirst, 1); ok {
+				firstPart, restPart := part, part
+				firstPart.Contents, restPart.Contents = first, rest
+				head := append(append([]lex.Line{}, parts[:k]...), firstPart)
+				tail := append([]lex.Line{restPart}, parts[k+1:]...)
+				return head, tail, true
+			}
+		}
+		break
+	}
+	if boundary < 0 {
+		return nil, nil, false
+	}
+	return parts[:boundary], parts[boundary:], true
+}
+
+// splitSentences splits text at the last sentence boundary for which the first part fits
+// in avail. Both parts need to have at least the given number of printed lines.
+func (t Tree) splitSentences(format rules.Format, text string, avail float64, minFirst, minRest int) (
+	string, string, bool) {
+	ends := sentenceEnd.FindAllStringIndex(text, -1)
+	for k := len(ends) - 1; k >= 0; k-- {
+		first := strings.TrimSpace(text[:ends[k][1]])
+		rest := strings.TrimSpace(text[ends[k][1]:])
+		if rest == "" {
+			continue
+		}
+		firstLines := t.lineCount(format, format.Prefix+first)
+		if float64(firstLines)*lineHeight > avail {
+			continue
+		}
+		if firstLines < minFirst || t.lineCount(format, rest+format.Postfix) < minRest {
+			return "", "", false
+		}
+		return first, rest, true
+	}
+	return "", "", false
+}
+
+// dualHeight returns the height of the taller column of a dual dialogue
+func (t Tree) dualHeight(left, right []lex.Line) float64 {
+	column := func(lines []lex.Line) float64 {
+		var height float64
+		for _, line := range lines {
+			height += float64(t.lineCountWidth(t.dualFormat(line.Type), line.Text(), dualColumnWidth)) * lineHeight
+		}
+		return height
+	}
+	return max(column(left), column(right))
+}
@@ -1,9 +1,15 @@
 package pdf
 
 import (
+	"bytes"
+	"math"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/LaPingvino/lexington/font"
 	"github.com/LaPingvino/lexington/lex"
 	"github.com/LaPingvino/lexington/rules"
 )
@@ -92,3 +98,381 @@ func TestCreatePDF(t *testing.T) {
 	// For manual inspection, you could print the temp file name.
 	// t.Logf("Generated test PDF at: %s", tmpfile.Name())
 }
+
+// newTestTree sets up a tree on a fresh document with the default rules
+func newTestTree(screenplay lex.Screenplay) *Tree {
+	tree := &Tree{PDF: newDocument(rules.LetterWidth, 11), Rules: rules.Default, F: screenplay}
+	tree.Begin()
+	return tree
+}
+
+func TestSplitDialogue(t *testing.T) {
+	tree := newTestTree(nil)
+	parts := []lex.Line{
+		{Type: lex.TypeParen, Contents: "(quietly)"},
+		{Type: lex.TypeDialog, Contents: "I went to the market. It was closed. " +
+			"So I walked home again and waited until the morning came around."},
+	}
+
+	first, rest, ok := tree.splitDialogue(parts, 3*lineHeight)
+	if !ok {
+		t.Fatal("Expected the speech to be split")
+	}
+	expectedFirst := []lex.Line{
+		parts[0],
+		{Type: lex.TypeDialog, Contents: "I went to the market. It was closed."},
+	}
+	expectedRest := []lex.Line{
+		{Type: lex.TypeDialog, Contents: "So I walked home again and waited until the morning came around."},
+	}
+	if !reflect.DeepEqual(first, expectedFirst) || !reflect.DeepEqual(rest, expectedRest) {
+		t.Errorf("Wrong split:\n%v\n%v", first, rest)
+	}
+
+	// A single sentence can't be split
+	_, _, ok = tree.splitDialogue(parts[1:2], lineHeight)
+	if ok {
+		t.Error("Expected no split when only part of a sentence fits")
+	}
+}
+
+func TestContinued(t *testing.T) {
+	tests := map[string]string{
+		"MARY":          "MARY (CONT'D)",
+		"MARY (V.O.)":   "MARY (V.O.) (CONT'D)",
+		"MARY (CONT'D)": "MARY (CONT'D)",
+		"MARY (cont'd)": "MARY (cont'd)",
+	}
+	for speaker, expected := range tests {
+		name, extensions := lex.SplitExtensions(speaker)
+		got := continued(lex.Line{Type: lex.TypeSpeaker, Contents: name, Extensions: extensions}).Text()
+		if got != expected {
+			t.Errorf("continued(%q) = %q, expected %q", speaker, got, expected)
+		}
+	}
+}
+
+func TestLongDialogueRunsOverPages(t *testing.T) {
+	speech := strings.Repeat("This is one more sentence of a very long speech. ", 150)
+	tree := newTestTree(lex.Screenplay{
+		{Type: lex.TypeSpeaker, Contents: "MARY"},
+		{Type: lex.TypeDialog, Contents: strings.TrimSpace(speech)},
+	})
+	tree.Render()
+	if pages := tree.PDF.PageCount(); pages < 2 {
+		t.Errorf("Expected the speech to continue on a next page, got %d page(s)", pages)
+	}
+	if err := tree.PDF.Error(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKeepTogether(t *testing.T) {
+	tests := map[string]lex.Screenplay{
+		"scene heading": {
+			{Type: lex.TypeScene, Contents: "INT. HOUSE - DAY"},
+			{Type: lex.TypeEmpty},
+			{Type: lex.TypeAction, Contents: "Mary enters."},
+		},
+		"transition": {
+			{Type: lex.TypeAction, Contents: "Mary leaves."},
+			{Type: lex.TypeEmpty},
+			{Type: lex.TypeTrans, Contents: "CUT TO:"},
+		},
+	}
+	for name, screenplay := range tests {
+		tree := newTestTree(screenplay)
+		_, pageHeight := tree.PDF.GetPageSize()
+		// Leave room for exactly one line
+		tree.PDF.SetY(pageHeight - 1 - lineHeight)
+		tree.breakBefore(0)
+		if tree.PDF.PageNo() != 2 {
+			t.Errorf("%s: expected a page break before the first element", name)
+		}
+	}
+}
+
+func TestPageLabels(t *testing.T) {
+	tree := newTestTree(lex.Screenplay{
+		{Type: lex.TypeTitlePage},
+		{Type: "Title", Contents: "A TEST"},
+		{Type: lex.TypeNewPage},
+		{Type: lex.TypeAction, Contents: "Page one."},
+		{Type: lex.TypeNewPage},
+		{Type: lex.TypeAction, Contents: "Page two."},
+		{Type: lex.TypeNewPage, Contents: "2A"},
+		{Type: lex.TypeAction, Contents: "Inserted page."},
+		{Type: lex.TypeNewPage},
+		{Type: lex.TypeAction, Contents: "Another inserted page."},
+	})
+	if tree.numbered {
+		t.Error("The title page shouldn't be numbered")
+	}
+
+	var labels []string
+	tree.PDF.SetHeaderFuncMode(func() {
+		tree.header()
+		labels = append(labels, tree.pageLabel)
+	}, true)
+	tree.Render()
+
+	expected := []string{"1", "2", "2A", "3"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Wrong page numbers %v, expected %v", labels, expected)
+	}
+}
+
+func TestHeaderLayout(t *testing.T) {
+	tests := []rules.Page{
+		{NumberAlign: "L", Header: "BLUE DRAFT"},
+		{NumberAlign: "L", Header: "BLUE DRAFT", Revision: "Blue Revision"},
+		{NumberAlign: "C", Header: "BLUE DRAFT", Revision: "Blue Revision"},
+		{NumberAlign: "R", Header: "A VERY LONG HEADER NAMING THE DRAFT, THE DATE AND THE READER", Revision: "Blue"},
+	}
+	for _, page := range tests {
+		tree := &Tree{PDF: newDocument(rules.LetterWidth, 11), Rules: rules.Default, Page: page}
+		tree.Begin()
+		cells := tree.headerCells()
+		if len(cells) != 2+min(len(page.Revision), 1) {
+			t.Fatalf("%+v: expected a cell for the number, header and revision, got %+v", page, cells)
+		}
+		if page.NumberAlign == "L" && cells[1].align != "R" {
+			t.Errorf("%+v: expected the header on the right of a left page number, got %q", page, cells[1].align)
+		}
+		for i, cell := range cells {
+			left, right := tree.cellSpan(cell)
+			for _, other := range cells[:i] {
+				otherLeft, otherRight := tree.cellSpan(other)
+				if cell.y == other.y && left < otherRight && otherLeft < right {
+					t.Errorf("%+v: %q overlaps %q", page, cell.text, other.text)
+				}
+			}
+		}
+	}
+}
+
+func TestSyntheticBold(t *testing.T) {
+	styles := map[string]bool{"": false, "I": false, "B": true, "b": true, "BI": true}
+	for style, stroked := range styles {
+		pdf := newDocument(rules.LetterWidth, 11)
+		pdf.SetCompression(false)
+		pdf.AddPage()
+		tree := Tree{PDF: pdf, Rules: rules.Default}
+		tree.linePrint(rules.Format{Font: "CourierPrime", Style: style, Size: 12, Left: 1.5, Right: 1}, "INT. HOUSE")
+
+		var buffer bytes.Buffer
+		if err := pdf.Output(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.Contains(buffer.Bytes(), []byte("\n2 Tr\n")); got != stroked {
+			t.Errorf("Style %q: expected emboldening to be %v", style, stroked)
+		}
+	}
+
+	// Emphasis inside the text is emboldened as well
+	pdf := newDocument(rules.LetterWidth, 11)
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	tree := Tree{PDF: pdf, Rules: rules.Default}
+	tree.linePrint(rules.Default.Get(lex.TypeAction), "Mary is **very** late.")
+	var buffer bytes.Buffer
+	if err := pdf.Output(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte("\n2 Tr\n")) {
+		t.Error("Expected **bold** text to be emboldened")
+	}
+}
+
+func TestLoadFonts(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "Test-Regular.ttf")
+	if err := os.WriteFile(regular, font.GetFont("CourierPrime", ""), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := newDocument(rules.LetterWidth, 11)
+	faces, err := loadFonts(pdf, map[string]rules.FontFiles{"Test": {Regular: regular}})
+	if err != nil {
+		t.Fatalf("loadFonts returned an unexpected error: %v", err)
+	}
+	tree := Tree{PDF: pdf, fonts: faces}
+	if face := tree.typeface("Test"); face.name != "Test" || !face.synthesizeBold("B") {
+		t.Errorf("Unexpected typeface %+v for a family without bold file", face)
+	}
+	if face := tree.typeface("Helvetica"); face.name != font.CourierPrimeName {
+		t.Errorf("Unconfigured fonts should fall back to %s, got %s", font.CourierPrimeName, face.name)
+	}
+
+	missing := filepath.Join(dir, "Missing-Bold.ttf")
+	_, err = loadFonts(newDocument(rules.LetterWidth, 11), map[string]rules.FontFiles{"Test": {Regular: regular, Bold: missing}})
+	if err == nil || !strings.Contains(err.Error(), "Bold") || !strings.Contains(err.Error(), missing) {
+		t.Errorf("Expected an error naming the missing Bold file, got %v", err)
+	}
+
+	_, err = loadFonts(newDocument(rules.LetterWidth, 11), map[string]rules.FontFiles{"Test": {Bold: regular}})
+	if err == nil {
+		t.Error("Expected an error for a family without Regular file")
+	}
+
+	junk := filepath.Join(dir, "Junk.ttf")
+	if err := os.WriteFile(junk, []byte("not a font"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadFonts(newDocument(rules.LetterWidth, 11), map[string]rules.FontFiles{"Test": {Regular: junk}})
+	if err == nil {
+		t.Error("Expected an error for a file that isn't a font")
+	}
+}
+
+func TestWriteToWriter(t *testing.T) {
+	screenplay := lex.Screenplay{
+		{Type: lex.TypeScene, Contents: "INT. HOUSE - DAY"},
+		{Type: lex.TypeAction, Contents: "Mary waits."},
+	}
+	var buffer bytes.Buffer
+	writer := &PDFWriter{Elements: rules.Default}
+	if err := writer.Write(&buffer, screenplay); err != nil {
+		t.Fatalf("PDFWriter.Write returned an unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(buffer.Bytes(), []byte("%PDF-")) {
+		t.Errorf("Expected a PDF document to be written, got %q", buffer.String()[:min(buffer.Len(), 20)])
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	screenplay := lex.Screenplay{{Type: lex.TypeAction, Contents: "Mary waits."}}
+	tests := []struct {
+		page     rules.Page
+		mediaBox string
+	}{
+		{rules.Page{}, "/MediaBox [0 0 612.00 792.00]"},
+		{rules.Page{Size: "A4"}, "/MediaBox [0 0 595.44 841.68]"},
+		{rules.Page{Width: 6, Height: 9}, "/MediaBox [0 0 432.00 648.00]"},
+	}
+	for _, tt := range tests {
+		var buffer bytes.Buffer
+		writer := &PDFWriter{Elements: rules.Default, Page: tt.page}
+		if err := writer.Write(&buffer, screenplay); err != nil {
+			t.Fatalf("PDFWriter.Write returned an unexpected error: %v", err)
+		}
+		if !strings.Contains(buffer.String(), tt.mediaBox) {
+			t.Errorf("Page %+v: expected %s in the document", tt.page, tt.mediaBox)
+		}
+	}
+
+	writer := &PDFWriter{Elements: rules.Default, Page: rules.Page{Size: "B52"}}
+	if err := writer.Write(&bytes.Buffer{}, screenplay); err == nil {
+		t.Error("Expected an error for an unknown page size")
+	}
+}
+
+func TestRevisionMarks(t *testing.T) {
+	revised := lex.Line{
+		Type: lex.TypeAction,
+		Contents: "Mary runs out of the house, down the street and around the corner, " +
+			"where she stops to catch her breath and looks back at the house one last time.",
+		Revision: 1,
+	}
+	tree := newTestTree(lex.Screenplay{{Type: lex.TypeRevision, Contents: "Blue Revision", Revision: 1}, revised})
+	if tree.revision != "Blue Revision" {
+		t.Errorf("Expected the latest revision in the header, got %q", tree.revision)
+	}
+
+	lines := tree.lineCount(tree.Rules.Get(revised.Type), revised.Contents)
+	page, y := tree.PDF.PageNo(), tree.PDF.GetY()
+	tree.pr(revised.Type, revised.Contents)
+	if marks := tree.markRevision(page, y); marks != lines || lines < 2 {
+		t.Errorf("Expected a mark for each of the %d lines, got %d", lines, marks)
+	}
+
+	// A revised element running over onto the next page is marked on both pages
+	_, pageHeight := tree.PDF.GetPageSize()
+	_, bottom := tree.PDF.GetAutoPageBreak()
+	tree.PDF.SetY(pageHeight - bottom - lineHeight)
+	page, y = tree.PDF.PageNo(), tree.PDF.GetY()
+	tree.pr(revised.Type, revised.Contents)
+	if tree.PDF.PageNo() != page+1 {
+		t.Fatalf("Expected the element to continue on page %d, it ended on page %d", page+1, tree.PDF.PageNo())
+	}
+	if marks := tree.markRevision(page, y); marks != lines {
+		t.Errorf("Expected a mark for each of the %d lines on both pages, got %d", lines, marks)
+	}
+
+	tree = &Tree{PDF: newDocument(rules.LetterWidth, 11), Rules: rules.Default, Page: rules.Page{Revision: "Pink"}}
+	tree.Begin()
+	if tree.revision != "Pink" {
+		t.Errorf("Expected the configured revision in the header, got %q", tree.revision)
+	}
+}
+
+// TestTitlePage checks that the title page keys end up in the blocks of the standard layout
+func TestTitlePage(t *testing.T) {
+	screenplay := lex.Screenplay{
+		{Type: lex.TypeTitlePage},
+		{Type: lex.KeyTitle, Contents: "BIG FISH"},
+		{Type: lex.KeyAuthor, Contents: "John August"},
+		{Type: lex.TypeMetaSection},
+		{Type: lex.KeyContact, Contents: "Agency\n123 Main Street\nLos Angeles"},
+		{Type: "Revision", Contents: "Blue"},
+		{Type: lex.KeyDraftDate, Contents: "1/1/2003"},
+		{Type: lex.TypeNewPage},
+		{Type: lex.TypeAction, Contents: "Edward enters."},
+	}
+	tree := newTestTree(screenplay)
+	if end := tree.renderTitlePage(0); end != 6 {
+		t.Errorf("Expected the title page to end at line 6, got %d", end)
+	}
+	if tree.PDF.PageNo() != 1 {
+		t.Errorf("Expected the title page to fit on one page, got %d pages", tree.PDF.PageNo())
+	}
+
+	// The draft date is printed last and ends at the bottom margin
+	_, pageHeight := tree.PDF.GetPageSize()
+	_, bottom := tree.PDF.GetAutoPageBreak()
+	if y := tree.PDF.GetY(); math.Abs(y-(pageHeight-bottom)) > 0.001 {
+		t.Errorf("Expected the draft date to end at %.3f, got %.3f", pageHeight-bottom, y)
+	}
+
+	meta := tree.Rules.Get("meta")
+	left := screenplay[4:6]
+	if height := tree.titleBlockHeight(meta, left); math.Abs(height-5*lineHeight) > 0.001 {
+		t.Errorf("Expected the contact block to be 5 lines high, got %.3f", height/lineHeight)
+	}
+	if text := screenplay[5].TitleText(); text != "Revision: Blue" {
+		t.Errorf("Expected other keys to be printed with their name, got %q", text)
+	}
+}
+
+// TestTitlePageNote checks that a note between two title page keys doesn't end the title page
+func TestTitlePageNote(t *testing.T) {
+	tree := newTestTree(lex.Screenplay{
+		{Type: lex.TypeTitlePage},
+		{Type: lex.KeyTitle, Contents: "BIG FISH"},
+		{Type: lex.TypeNote, Contents: "a note"},
+		{Type: lex.KeyAuthor, Contents: "John August"},
+		{Type: lex.TypeNewPage},
+		{Type: lex.TypeAction, Contents: "Edward enters."},
+	})
+	tree.Render()
+	if pages := tree.PDF.PageCount(); pages != 2 {
+		t.Errorf("Expected a title page and one page of screenplay, got %d pages", pages)
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	action := lex.Line{Type: lex.TypeAction, Contents: "Mary waits.\n\n\tNothing happens."}
+	tree := newTestTree(lex.Screenplay{action})
+	if height := tree.height(action); math.Abs(height-3*lineHeight) > 0.001 {
+		t.Errorf("Expected the paragraph to take up 3 lines, got %.3f inches", height)
+	}
+
+	start := tree.PDF.GetY()
+	tree.Render()
+	if printed := tree.PDF.GetY() - start; math.Abs(printed-3*lineHeight) > 0.001 {
+		t.Errorf("Expected 3 printed lines, got %.3f inches", printed)
+	}
+	if err := tree.PDF.Error(); err != nil {
+		t.Error(err)
+	}
+}
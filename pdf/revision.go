@@ -0,0 +1,45 @@
+package pdf
+
+import "math"
+
+const (
+	revisionMark       = "*"  // Printed next to revised lines
+	revisionMarkOffset = 0.75 // Distance of the revision marks from the right edge of the paper in inches
+)
+
+// markRevision prints revision marks next to every line printed since startY on the given page.
+// When the element ran over onto the next pages, the lines on each of those pages are marked.
+// It returns the number of marks printed.
+func (t Tree) markRevision(page int, startY float64) int {
+	current, endY := t.PDF.PageNo(), t.PDF.GetY()
+	_, top, _, _ := t.PDF.GetMargins()
+	_, pageHeight := t.PDF.GetPageSize()
+	_, bottom := t.PDF.GetAutoPageBreak()
+	count := 0
+	for ; page < current; page++ {
+		t.PDF.SetPage(page)
+		// Only whole lines fit above the bottom margin
+		lines := math.Floor((pageHeight - bottom - startY + 0.001) / lineHeight)
+		count += t.markLines(startY, startY+lines*lineHeight)
+		startY = top
+	}
+	t.PDF.SetPage(current)
+	return count + t.markLines(startY, endY)
+}
+
+// markLines prints a revision mark in the right margin next to every line between startY and endY
+func (t Tree) markLines(startY, endY float64) int {
+	pageWidth, _ := t.PDF.GetPageSize()
+	x, y := t.PDF.GetXY()
+	t.setPageFont()
+	_, fontSize := t.PDF.GetFontSize()
+
+	count := 0
+	for lineY := startY; lineY < endY-lineHeight/2; lineY += lineHeight {
+		// Same baseline as text printed in a cell of one line height
+		t.PDF.Text(pageWidth-revisionMarkOffset, lineY+lineHeight/2+0.3*fontSize, revisionMark)
+		count++
+	}
+	t.PDF.SetXY(x, y)
+	return count
+}
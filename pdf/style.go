@@ -0,0 +1,119 @@
+package pdf
+
+import (
+	"strings"
+
+	"github.com/LaPingvino/lexington/lex"
+	"github.com/phpdave11/gofpdf"
+)
+
+// boldStroke is the outline width, relative to the font size, used to embolden
+// fonts that don't have a bold face by stroking the glyphs after filling them.
+const boldStroke = 0.03
+
+// PDF text rendering modes, see SetTextRenderingMode
+const (
+	renderFill          = 0
+	renderFillAndStroke = 2
+)
+
+// typeface is a font family registered in the document
+type typeface struct {
+	name       string // Family name in the document
+	bold       bool   // The family has a real bold face
+	boldItalic bool   // The family has a real bold italic face
+}
+
+// synthesizeBold returns true if the style is bold but the family has no face for it
+func (f typeface) synthesizeBold(style string) bool {
+	style = strings.ToUpper(style)
+	if !strings.Contains(style, "B") {
+		return false
+	}
+	if strings.Contains(style, "I") {
+		return !f.boldItalic
+	}
+	return !f.bold
+}
+
+// setFont selects a font. Bold styles of fonts without a real bold face
+// are synthesized by drawing the outline of the glyphs as well.
+func setFont(pdf *gofpdf.Fpdf, face typeface, style string, size float64) {
+	pdf.SetFont(face.name, style, size)
+	if face.synthesizeBold(style) {
+		// The font size is in points, the document unit in inches
+		pdf.SetLineWidth(size * boldStroke / 72)
+		pdf.SetTextRenderingMode(renderFillAndStroke)
+		return
+	}
+	pdf.SetTextRenderingMode(renderFill)
+}
+
+// fontStyles are the letters gofpdf uses for the emphasis styles
+var fontStyles = []struct {
+	style  lex.Style
+	letter string
+}{
+	{lex.Bold, "B"},
+	{lex.Italic, "I"},
+	{lex.Underline, "U"},
+}
+
+// runStyle returns the font style of a run of text, adding its emphasis to the base style
+func runStyle(baseStyle string, style lex.Style) string {
+	s := strings.ToUpper(baseStyle)
+	for _, f := range fontStyles {
+		if style.Has(f.style) && !strings.Contains(s, f.letter) {
+			s += f.letter
+		}
+	}
+	return s
+}
+
+// isPlain returns true if none of the runs of text has emphasis
+func isPlain(runs []lex.Run) bool {
+	for _, run := range runs {
+		if run.Style != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeStyled writes runs of text with emphasis, switching the style of the base font
+// for each run. It returns the height of the written text.
+func writeStyled(pdf *gofpdf.Fpdf, face typeface, baseStyle string, size float64, align string, runs []lex.Run) float64 {
+	startY := pdf.GetY()
+	if align == "C" || align == "R" {
+		alignStyled(pdf, face, baseStyle, size, align, runs)
+	}
+	for _, run := range runs {
+		setFont(pdf, face, runStyle(baseStyle, run.Style), size)
+		pdf.Write(lineHeight, run.Text)
+	}
+	setFont(pdf, face, baseStyle, size)
+	pdf.SetY(pdf.GetY() + lineHeight)
+	return pdf.GetY() - startY
+}
+
+// alignStyled moves the cursor so that styled text fitting on a single line ends up centered
+// or right aligned. Longer text is left aligned.
+func alignStyled(pdf *gofpdf.Fpdf, face typeface, baseStyle string, size float64, align string, runs []lex.Run) {
+	var width float64
+	for _, run := range runs {
+		setFont(pdf, face, runStyle(baseStyle, run.Style), size)
+		width += pdf.GetStringWidth(run.Text)
+	}
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	space := pageWidth - left - right - 2*pdf.GetCellMargin()
+	if width > space {
+		return
+	}
+	offset := space - width
+	if align == "C" {
+		offset /= 2
+	}
+	pdf.SetX(left + pdf.GetCellMargin() + offset)
+}
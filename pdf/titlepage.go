@@ -0,0 +1,87 @@
+package pdf
+
+import (
+	"strings"
+
+	"github.com/LaPingvino/lexington/internal"
+	"github.com/LaPingvino/lexington/lex"
+	"github.com/LaPingvino/lexington/rules"
+)
+
+// The title page follows the standard layout: the title, credit, author and source centered
+// a third down the page, the contact details and other keys at the bottom left and the draft
+// date at the bottom right. Keys are separated by a blank line.
+
+// titleTop is the position of the title as a fraction of the page height
+const titleTop = 1.0 / 3
+
+// renderTitlePage lays out the title page starting at index i and returns the index of its
+// last key, so the page break that ends the title page is handled like any other.
+func (t *Tree) renderTitlePage(i int) int {
+	_, title := t.F[i:].SplitTitlePage()
+	var center, left, right lex.Screenplay
+	for _, line := range title.TitlePage() {
+		switch lex.TitlePlacement(line.Type) {
+		case lex.TitleCenter:
+			center = append(center, line)
+		case lex.TitleRight:
+			right = append(right, line)
+		default:
+			left = append(left, line)
+		}
+		if line.Type == lex.KeyTitle {
+			t.PDF.SetTitle(strings.ReplaceAll(line.Contents, "\n", " "), true)
+		}
+	}
+
+	// The bottom blocks end right at the bottom margin, which mustn't start a new page
+	_, pageHeight := t.PDF.GetPageSize()
+	_, bottom := t.PDF.GetAutoPageBreak()
+	t.PDF.SetAutoPageBreak(false, bottom)
+	defer t.PDF.SetAutoPageBreak(true, bottom)
+
+	t.PDF.SetY(pageHeight * titleTop)
+	t.printTitleBlock(t.Rules.Get(internal.ElementTitle), center)
+
+	meta := t.Rules.GetWithKey(rules.KeyMeta)
+	t.PDF.SetY(pageHeight - bottom - t.titleBlockHeight(meta, left))
+	t.printTitleBlock(meta, left)
+	meta.Align = "R"
+	t.PDF.SetY(pageHeight - bottom - t.titleBlockHeight(meta, right))
+	t.printTitleBlock(meta, right)
+
+	end := i + len(title) - 1
+	if title[len(title)-1].Type == lex.TypeNewPage {
+		return end - 1
+	}
+	// The screenplay starts on a new page, even if the page break is missing
+	t.numbered = true
+	t.PDF.AddPage()
+	return end
+}
+
+// printTitleBlock prints title page keys below each other, every line of their values on a row of its own
+func (t Tree) printTitleBlock(format rules.Format, keys lex.Screenplay) {
+	for k, key := range keys {
+		if k > 0 {
+			t.PDF.SetY(t.PDF.GetY() + lineHeight)
+		}
+		for _, row := range strings.Split(key.TitleText(), "\n") {
+			t.linePrint(format, row)
+		}
+	}
+}
+
+// titleBlockHeight returns the height of title page keys as printed by printTitleBlock
+func (t Tree) titleBlockHeight(format rules.Format, keys lex.Screenplay) float64 {
+	var height float64
+	for k, key := range keys {
+		if k > 0 {
+			height += lineHeight
+		}
+		for _, row := range strings.Split(key.TitleText(), "\n") {
+			height += float64(t.lineCount(format, row)) * lineHeight
+		}
+	}
+	return height
+}
@@ -0,0 +1,40 @@
+package rules
+
+import "path/filepath"
+
+// FontFiles lists the TTF or OTF files of a font family, one per style.
+// Only Regular is required. Missing italic styles fall back to the regular face,
+// missing bold styles are synthesized from the regular or italic face.
+type FontFiles struct {
+	Regular    string
+	Bold       string
+	Italic     string
+	BoldItalic string
+}
+
+// Styles returns the files by gofpdf style string, leaving out styles without a file
+func (f FontFiles) Styles() map[string]string {
+	styles := map[string]string{}
+	for style, file := range map[string]string{"": f.Regular, "B": f.Bold, "I": f.Italic, "BI": f.BoldItalic} {
+		if file != "" {
+			styles[style] = file
+		}
+	}
+	return styles
+}
+
+// relativeTo resolves relative file paths against the given directory
+func (f FontFiles) relativeTo(dir string) FontFiles {
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+	return FontFiles{
+		Regular:    resolve(f.Regular),
+		Bold:       resolve(f.Bold),
+		Italic:     resolve(f.Italic),
+		BoldItalic: resolve(f.BoldItalic),
+	}
+}
@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// LetterWidth is the paper width in inches the element margins are measured for
+const LetterWidth = 8.5
+
+// PaperSizes are the known paper sizes by lower case name, width and height in inches
+var PaperSizes = map[string][2]float64{
+	"letter": {8.5, 11},
+	"legal":  {8.5, 14},
+	"a4":     {8.27, 11.69},
+}
+
+// Page holds the page layout settings used by paginated output like PDF.
+// The zero value gives the standard layout: page numbers in the top right corner
+// of every page after the title page, formatted like "12." and no header or footer on US Letter paper.
+type Page struct {
+	Size            string  // Paper size: Letter, Legal or A4. Default Letter
+	Width           float64 // Custom paper width in inches, used together with Height instead of Size
+	Height          float64 // Custom paper height in inches
+	HideNumbers     bool    // Don't print page numbers at all
+	SkipFirstNumber bool    // Leave out the number on the first page after the title page
+	NumberFormat    string  // Format of the page number, the first %s is replaced by the number. Default "%s."
+	NumberAlign     string  // Alignment of the page number: L, C or R. Default R
+	Header          string  // Text printed top left, or top right with the number left, e.g. a draft name
+	Footer          string  // Text printed centered at the bottom of every numbered page, e.g. CONFIDENTIAL
+	Revision        string  // Revision printed in the header, e.g. Blue Revision. Default the latest revision set
+	HeaderY         float64 // Distance of the header from the top of the page in inches. Default 0.5
+	FooterY         float64 // Distance of the footer from the bottom of the page in inches. Default 0.5
+}
+
+// WithDefaults returns the page settings with defaults filled in for missing values
+func (p Page) WithDefaults() Page {
+	if p.NumberFormat == "" {
+		p.NumberFormat = "%s."
+	}
+	// A format without %s is printed before the number, e.g. "Page " gives "Page 12"
+	if !strings.Contains(p.NumberFormat, "%s") {
+		p.NumberFormat += "%s"
+	}
+	if p.NumberAlign == "" {
+		p.NumberAlign = "R"
+	}
+	if p.HeaderY == 0 {
+		p.HeaderY = 0.5
+	}
+	if p.FooterY == 0 {
+		p.FooterY = 0.5
+	}
+	return p
+}
+
+// Dimensions returns the width and height of the paper in inches
+func (p Page) Dimensions() (float64, float64, error) {
+	if p.Width > 0 || p.Height > 0 {
+		if p.Width <= 0 || p.Height <= 0 {
+			return 0, 0, fmt.Errorf("custom page size needs both Width and Height, got %gx%g", p.Width, p.Height)
+		}
+		return p.Width, p.Height, nil
+	}
+	if p.Size == "" {
+		return LetterWidth, 11, nil
+	}
+	size, ok := PaperSizes[strings.ToLower(p.Size)]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown page size %s, use Letter, Legal, A4 or a custom Width and Height", p.Size)
+	}
+	return size[0], size[1], nil
+}
+
+// SizeName returns the name of the paper size, or an empty string for custom sizes
+func (p Page) SizeName() string {
+	if p.Width > 0 || p.Height > 0 {
+		return ""
+	}
+	if p.Size == "" {
+		return "Letter"
+	}
+	return p.Size
+}
+
+// ForWidth returns a copy of the set for paper of the given width. The right margins
+// change by the difference with Letter paper, so lines keep their length.
+func (s Set) ForWidth(width float64) Set {
+	if s == nil || width == LetterWidth {
+		return s
+	}
+	adjusted := make(Set, len(s))
+	for key, format := range s {
+		// Rounded to hundredths of an inch to avoid floating point noise in the output
+		format.Right = max(math.Round((format.Right+width-LetterWidth)*100)/100, 0)
+		adjusted[key] = format
+	}
+	return adjusted
+}
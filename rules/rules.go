@@ -40,6 +40,7 @@ const (
 	KeyMeta        ConfigKey = "meta"
 	KeyCenter      ConfigKey = "center"
 	KeyLyrics      ConfigKey = "lyrics"
+	KeyBoneyard    ConfigKey = "boneyard"
 )
 
 // String returns the string representation of the key
@@ -52,7 +53,7 @@ func (k ConfigKey) IsValid() bool {
 	switch k {
 	case KeyAction, KeySpeaker, KeyDialog, KeyScene, KeyParen, KeyTrans,
 		KeyNote, KeyAllCaps, KeyEmpty, KeyDualSpeaker, KeyDualDialog,
-		KeyDualParen, KeyTitle, KeyMeta, KeyCenter, KeyLyrics:
+		KeyDualParen, KeyTitle, KeyMeta, KeyCenter, KeyLyrics, KeyBoneyard:
 		return true
 	default:
 		return false
@@ -191,6 +192,13 @@ var Default = Set{
 	"note": {
 		Left:  1.5,
 		Right: 1,
+		Style: "i",
+		Hide:  true,
+	},
+	"boneyard": {
+		Left:  1.5,
+		Right: 1,
+		Hide:  true,
 	},
 	"allcaps": {
 		Left:  1.5,
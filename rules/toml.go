@@ -5,14 +5,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/BurntSushi/toml"
 )
 
 type TOMLConf struct {
-	Elements map[string]Set      `toml:"Elements"`
-	Scenes   map[string][]string `toml:"Scenes"`
-	metadata toml.MetaData
+	AutoContd bool                 `toml:"AutoContd"` // Add (CONT'D) to characters who speak again after only action
+	Elements  map[string]Set       `toml:"Elements"`
+	Scenes    map[string][]string  `toml:"Scenes"`
+	Page      Page                 `toml:"Page"`
+	Fonts     map[string]FontFiles `toml:"Fonts"`
+	metadata  toml.MetaData
 }
 
 func ReadFile(file string) (TOMLConf, error) {
@@ -28,6 +32,11 @@ func ReadFile(file string) (TOMLConf, error) {
 		return r, fmt.Errorf("failed to parse TOML file %s: %w", file, err)
 	}
 
+	// Font files are looked up next to the configuration file
+	for family, files := range r.Fonts {
+		r.Fonts[family] = files.relativeTo(filepath.Dir(file))
+	}
+
 	r.metadata = m
 	return r, nil
 }
@@ -25,6 +25,7 @@ declare -A test_files=(
     ["complex_screenplay.fountain"]="Advanced formatting test"
     ["no_title.fountain"]="No title page edge case"
     ["fountain_example.fountain"]="Original fountain example"
+    ["spec_rules.fountain"]="Block-level rules of the Fountain spec"
 )
 
 # Output formats to test